@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/paypermint/bridge-app-svc/helpers"
+	"github.com/paypermint/bridge-app-svc/models"
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+//GetCircuitBreakers renders the circuit breaker state of every upstream
+func GetCircuitBreakers(w http.ResponseWriter, req *http.Request) {
+	breakers := []*models.CircuitBreaker{}
+	for _, breaker := range helpers.GetCircuitBreakers() {
+		breakers = append(breakers, breaker.ToAPIResponse())
+	}
+	util.RenderJSON(appCtx, w, http.StatusOK, models.List{
+		TotalCount: int64(len(breakers)),
+		Object:     "list",
+		Data:       breakers,
+	})
+}
@@ -1,10 +1,27 @@
 package handlers
 
-import "github.com/paypermint/appkit"
+import (
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/helpers"
+)
 
-var appCtx *appkit.AppContext
+var (
+	appCtx     *appkit.AppContext
+	jobManager *helpers.JobManager
+	scheduler  *helpers.Scheduler
+)
 
 //SetAppContext sets the application context in the handlers
 func SetAppContext(ac *appkit.AppContext) {
 	appCtx = ac
 }
+
+//SetJobManager sets the job manager running the sync jobs
+func SetJobManager(jm *helpers.JobManager) {
+	jobManager = jm
+}
+
+//SetScheduler sets the scheduler running the invoice schedules
+func SetScheduler(s *helpers.Scheduler) {
+	scheduler = s
+}
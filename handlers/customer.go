@@ -1,14 +1,25 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"strings"
 
 	"github.com/paypermint/appkit"
 	"github.com/paypermint/bridge-app-svc/helpers"
+	"github.com/paypermint/bridge-app-svc/models"
 	"github.com/paypermint/bridge-app-svc/util"
 )
 
+const (
+	// multipartOverhead is allowed on top of the maximum upload size for the other parts and boundaries
+	multipartOverhead = 1 << 20
+	// maxFormValueSize bounds the non file parts of an upload
+	maxFormValueSize = 1 << 10
+)
+
 //POST Operations
 
 //SyncCustomers perfors syncing of customers between our end and at SAP end
@@ -24,75 +35,272 @@ func SyncCustomers(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	params, _, _ := helpers.GetRequestParams(req, "POST")
-	if field, ok := helpers.HasUnsupportedParameters(params, util.KeyFilePath); ok {
+	if field, ok := helpers.HasUnsupportedParameters(params, util.KeyFilePath, util.KeySource, util.KeyMappingProfile, util.KeySheet, util.KeyDryRun,
+		util.KeyDeactivateMissing); ok {
 		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.UnsupportedParamMsg, field)
 		return
 	}
+	dryRun, err := helpers.GetOptionalBoolParam(params, util.KeyDryRun)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyDryRun)
+		return
+	}
+	deactivateMissing, err := helpers.GetOptionalBoolParam(params, util.KeyDeactivateMissing)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyDeactivateMissing)
+		return
+	}
+	syncReq := &helpers.CustomerSyncRequest{
+		ProfileID:         util.ProfileIDFromHTTPRequest(req),
+		Client:            helpers.NewClient(basicAuthCreds, bearerTokenCreds, req.RemoteAddr),
+		DryRun:            dryRun,
+		DeactivateMissing: deactivateMissing,
+		Logger:            ctxLogger,
+	}
+
+	//Mandatory unless file_path is given
+	if _, ok := params[util.KeySource]; ok {
+		if _, ok := params[util.KeyFilePath]; ok {
+			util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidPostParameterMsg, util.KeySource)
+			return
+		}
+		source, err := helpers.GetStringParam(params, util.KeySource)
+		if err != nil {
+			util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeySource)
+			return
+		}
+		syncCustomersFromS3(w, req, syncReq, source, params[util.KeyMappingProfile], params[util.KeySheet])
+		return
+	}
 
-	//Mandatory
-	filePath, err := helpers.GetStringParam(params, util.KeyFilePath)
+	//Mandatory unless source is given
+	fileName, err := helpers.GetStringParam(params, util.KeyFilePath)
 	if err != nil {
 		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyFilePath)
 		return
 	}
+	filePath, err := helpers.ResolveStagedFile(fileName)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidPostParameterMsg, util.KeyFilePath)
+		return
+	}
+
+	syncCustomersFromFile(w, req, syncReq, filePath, params[util.KeyMappingProfile], params[util.KeySheet], util.KeyFilePath, nil)
+}
+
+//UploadCustomers syncs the customers of a CSV or XLSX file uploaded as multipart/form-data, a CSV file may be gzip or zip compressed
+func UploadCustomers(w http.ResponseWriter, req *http.Request) {
+	ctxLogger := appkit.GetContextLogger(appCtx.Logger, req)
+
+	ctxLogger.Info("inside UploadCustomers")
+
+	basicAuthCreds, bearerTokenCreds, err := helpers.GetCredentialsFromRequestHeader(req)
+	if err != nil {
+		ctxLogger.Crit(err.Error())
+		util.RenderAPIErrorJSON(appCtx, w)
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get(util.KeyContentType))
+	if err != nil || mediaType != "multipart/form-data" {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidParameterMsg, util.KeyContentType)
+		return
+	}
 
-	customersData, err := helpers.ReadCSVFile(filePath)
+	req.Body = http.MaxBytesReader(w, req.Body, helpers.GetMaxUploadSize()+multipartOverhead)
+	reader, err := req.MultipartReader()
 	if err != nil {
-		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyFilePath)
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyContentType)
 		return
 	}
 
-	// customersDataFromS3, err := helpers.GetS3File(ctxLogger, "", "", "", "customers.csv", mux.Vars(req)["id"])
-	// if err != nil {
-	// 	ctxLogger.Error(err.Error())
-	// 	return
-	// }
-	//
-	// for _, customerData := range customersDataFromS3 {
-	// 	fmt.Println(customerData)
-	// }
+	var stagedFile string
+	params := map[string]string{}
+	defer func() {
+		if stagedFile != helpers.EmptyString {
+			helpers.RemoveStagedFile(stagedFile)
+		}
+	}()
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			renderUploadError(w, err, helpers.EmptyString)
+			return
+		}
+
+		switch part.FormName() {
+		case util.KeyFile:
+			if stagedFile != helpers.EmptyString {
+				util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidPostParameterMsg, util.KeyFile)
+				return
+			}
+			stagedFile, err = helpers.StageUpload(part)
+			if err != nil {
+				renderUploadError(w, err, util.KeyFile)
+				return
+			}
+		case util.KeyMappingProfile, util.KeySheet, util.KeyDryRun, util.KeyDeactivateMissing:
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValueSize))
+			if err != nil {
+				renderUploadError(w, err, part.FormName())
+				return
+			}
+			params[part.FormName()] = strings.TrimSpace(string(value))
+		default:
+			util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.UnsupportedParamMsg, part.FormName())
+			return
+		}
+	}
+
+	if stagedFile == helpers.EmptyString {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.MissingMandatoryField, util.KeyFile)
+		return
+	}
+	dryRun, err := helpers.GetOptionalBoolParam(params, util.KeyDryRun)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyDryRun)
+		return
+	}
+	deactivateMissing, err := helpers.GetOptionalBoolParam(params, util.KeyDeactivateMissing)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyDeactivateMissing)
+		return
+	}
+	filePath, err := helpers.ResolveStagedFile(stagedFile)
+	if err != nil {
+		ctxLogger.Crit(err.Error())
+		util.RenderAPIErrorJSON(appCtx, w)
+		return
+	}
 
-	client := helpers.NewClient(basicAuthCreds, bearerTokenCreds, req.RemoteAddr)
-	for index, customerData := range customersData {
+	// the staged file is streamed by the job and removed once it is done with it
+	uploadedFile := stagedFile
+	stagedFile = helpers.EmptyString
+	syncReq := &helpers.CustomerSyncRequest{
+		ProfileID:         util.ProfileIDFromHTTPRequest(req),
+		Client:            helpers.NewClient(basicAuthCreds, bearerTokenCreds, req.RemoteAddr),
+		DryRun:            dryRun,
+		DeactivateMissing: deactivateMissing,
+		Logger:            ctxLogger,
+	}
+	syncCustomersFromFile(w, req, syncReq, filePath, params[util.KeyMappingProfile], params[util.KeySheet], util.KeyFile, func() error {
+		return helpers.RemoveStagedFile(uploadedFile)
+	})
+}
 
-		if index == 0 {
-			continue
+// syncCustomersFromFile submits the customer sync job for a customer file, fileField names the request field the file came from.
+// sheet selects the sheet of a workbook, cleanup, when given, runs once the file is no longer read
+func syncCustomersFromFile(w http.ResponseWriter, req *http.Request, syncReq *helpers.CustomerSyncRequest, filePath, mappingProfileName, sheet, fileField string, cleanup func() error) {
+	records, err := helpers.OpenRecordFile(filePath, sheet)
+	if err != nil {
+		if cleanup != nil {
+			cleanup()
+		}
+		if err == helpers.ErrUnknownSheet {
+			util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidPostParameterMsg, util.KeySheet)
+			return
 		}
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), fileField)
+		return
+	}
+	if cleanup != nil {
+		records.AfterClose(cleanup)
+	}
 
-		var notesJSON map[string]interface{}
-
-		// Unmarshal or Decode the JSON to the interface.
-		json.Unmarshal([]byte(customerData[14]), &notesJSON)
-		createCustomerRequest := &helpers.CreateCustomerRequest{
-			Name:      customerData[0],
-			Email:     customerData[1],
-			ContactNo: customerData[2],
-			BillingAddress: &helpers.Address{
-				AddressLine1: customerData[3],
-				AddressLine2: customerData[4],
-				City:         customerData[5],
-				State:        customerData[6],
-				Pin:          customerData[7],
-			},
-			ShippingAddress: &helpers.Address{
-				AddressLine1: customerData[8],
-				AddressLine2: customerData[9],
-				City:         customerData[10],
-				State:        customerData[11],
-				Pin:          customerData[12],
-			},
-			Gstin:              customerData[13],
-			Notes:              notesJSON,
-			MerchantCustomerID: customerData[15],
-			HasPortalAccess:    true,
+	mappingProfile, err := helpers.GetMappingProfile(mappingProfileName)
+	if err != nil {
+		records.Close()
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidPostParameterMsg, util.KeyMappingProfile)
+		return
+	}
+	mapper, err := mappingProfile.ReadCustomerMapper(records)
+	if err != nil {
+		records.Close()
+		if missingColumnErr, ok := err.(*helpers.MissingColumnError); ok {
+			util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, missingColumnErr.Error(), missingColumnErr.Column)
+			return
 		}
-		err := client.CreateCustomer(createCustomerRequest)
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), fileField)
+		return
+	}
+
+	job, err := jobManager.Submit(req.Context(), syncReq.ProfileID, helpers.JobTypeCustomerSync, helpers.SyncCustomersJob(syncReq, mapper, records))
+	if err != nil {
+		records.Close()
+	}
+	renderJobAccepted(w, req, job, err)
+}
+
+// syncCustomersFromS3 submits a customer sync job for an s3://bucket/key source, or one job for every
+// new object when the source is an s3://bucket/prefix/
+func syncCustomersFromS3(w http.ResponseWriter, req *http.Request, syncReq *helpers.CustomerSyncRequest, source, mappingProfileName, sheet string) {
+	ctxLogger := appkit.GetContextLogger(appCtx.Logger, req)
+
+	mappingProfile, err := helpers.GetMappingProfile(mappingProfileName)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidPostParameterMsg, util.KeyMappingProfile)
+		return
+	}
+	bucket, key, err := helpers.ParseS3URL(source)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidPostParameterMsg, util.KeySource)
+		return
+	}
+	if !helpers.IsS3Prefix(key) {
+		object := &helpers.S3Object{Bucket: bucket, Key: key}
+		job, err := jobManager.Submit(req.Context(), syncReq.ProfileID, helpers.JobTypeCustomerSync, helpers.SyncS3CustomersJob(syncReq, mappingProfile, sheet, object))
+		renderJobAccepted(w, req, job, err)
+		return
+	}
+
+	if syncReq.DeactivateMissing {
+		// every object of a prefix holds only part of the customers
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidPostParameterMsg, util.KeyDeactivateMissing)
+		return
+	}
+	objects, err := helpers.ListNewS3Objects(req.Context(), bucket, key)
+	if err != nil {
+		ctxLogger.Crit(err.Error())
+		util.RenderAPIErrorJSON(appCtx, w)
+		return
+	}
+	jobs := []*models.Job{}
+	for _, object := range objects {
+		job, err := jobManager.Submit(req.Context(), syncReq.ProfileID, helpers.JobTypeCustomerSync, helpers.SyncS3CustomersJob(syncReq, mappingProfile, sheet, object))
 		if err != nil {
-			ctxLogger.Crit(err.Error())
-			util.RenderAPIErrorJSON(appCtx, w)
-			return
+			// the objects left out are still new and get picked up by the next listing
+			ctxLogger.Error("unable to submit customer sync job", "bucket", bucket, "key", object.Key, "error_message", err.Error())
+			break
 		}
+		jobs = append(jobs, job.ToAPIResponse())
+	}
+	if len(objects) > 0 && len(jobs) == 0 {
+		renderJobAccepted(w, req, nil, helpers.ErrJobQueueFull)
+		return
+	}
+
+	status := http.StatusAccepted
+	if len(jobs) == 0 {
+		status = http.StatusOK
+	}
+	util.RenderJSON(appCtx, w, status, models.List{
+		TotalCount: int64(len(jobs)),
+		Object:     "list",
+		Data:       jobs,
+	})
+}
+
+// renderUploadError renders the response for an upload which could not be read
+func renderUploadError(w http.ResponseWriter, err error, field string) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case err == helpers.ErrUploadTooLarge || errors.As(err, &maxBytesErr):
+		util.RenderErrorJSON(appCtx, w, http.StatusRequestEntityTooLarge, util.UploadTooLargeMsg, field)
+	case err == helpers.ErrUnsupportedContent:
+		util.RenderErrorJSON(appCtx, w, http.StatusUnsupportedMediaType, util.UnsupportedFileContentMsg, field)
+	default:
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidPostParameterMsg, field)
 	}
-	util.RenderJSON(appCtx, w, http.StatusOK, "OK!")
-	return
 }
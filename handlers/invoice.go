@@ -3,16 +3,95 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/paypermint/appkit"
 	"github.com/paypermint/bridge-app-svc/helpers"
 	"github.com/paypermint/bridge-app-svc/util"
 )
 
 //SyncInvoices performs syncing of invoices between payabbhi & other system
 func SyncInvoices(w http.ResponseWriter, req *http.Request) {
-	syncWith := req.Header.Get("sync_with")
+	ctxLogger := appkit.GetContextLogger(appCtx.Logger, req)
 
-	if syncWith == util.SyncWithSAP {
-		helpers.SyncInvoicesWithSAP(w, req, appCtx)
+	syncWith := req.Header.Get(util.KeySyncWith)
+	if !helpers.HasConnector(syncWith) {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.UnsupportedConnectorMsg, util.KeySyncWith)
+		return
 	}
 
+	basicAuthCreds, bearerTokenCreds, err := helpers.GetCredentialsFromRequestHeader(req)
+	if err != nil {
+		ctxLogger.Crit(err.Error())
+		util.RenderAPIErrorJSON(appCtx, w)
+		return
+	}
+	params, _, _ := helpers.GetRequestParams(req, "PUT")
+	if field, ok := helpers.HasUnsupportedParameters(params, util.KeyMerchantCustomerID, util.KeyCustomerID, util.KeyDryRun); ok {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.UnsupportedParamMsg, field)
+		return
+	}
+
+	dryRun, err := helpers.GetOptionalBoolParam(params, util.KeyDryRun)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyDryRun)
+		return
+	}
+
+	//Mandatory
+	merchantCustomerID, err := helpers.GetStringParam(params, util.KeyMerchantCustomerID)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyMerchantCustomerID)
+		return
+	}
+
+	//Mandatory unless the customer was created by an earlier customer sync
+	profileID := util.ProfileIDFromHTTPRequest(req)
+	if _, present := params[util.KeyCustomerID]; !present {
+		syncedCustomer, err := helpers.GetStore().GetCustomer(profileID, merchantCustomerID)
+		if err == helpers.ErrNotFound {
+			util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.MissingMandatoryField, util.KeyCustomerID)
+			return
+		}
+		if err != nil {
+			ctxLogger.Crit(err.Error())
+			util.RenderAPIErrorJSON(appCtx, w)
+			return
+		}
+		params[util.KeyCustomerID] = syncedCustomer.CustomerID
+	}
+	if _, err := helpers.GetStringParam(params, util.KeyCustomerID); err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyCustomerID)
+		return
+	}
+
+	job, err := jobManager.Submit(req.Context(), profileID, helpers.JobTypeInvoiceSync, helpers.SyncInvoicesJob(&helpers.InvoiceSyncRequest{
+		ProfileID:          profileID,
+		SyncWith:           syncWith,
+		MerchantCustomerID: merchantCustomerID,
+		Params:             params,
+		Platform:           req.Header.Get("Platform"),
+		DryRun:             dryRun,
+		ConnectorOptions:   helpers.NewConnectorOptions(appCtx, req),
+		PayabbhiClient:     helpers.NewClient(basicAuthCreds, bearerTokenCreds, req.RemoteAddr),
+		Logger:             ctxLogger,
+	}))
+	renderJobAccepted(w, req, job, err)
+}
+
+// getConnector creates the connector named by syncWith, rendering the error response when it cannot
+func getConnector(w http.ResponseWriter, req *http.Request, syncWith string) (helpers.Connector, bool) {
+	connector, err := helpers.GetConnector(syncWith, helpers.NewConnectorOptions(appCtx, req))
+	if err == helpers.ErrUnknownConnector {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.UnsupportedConnectorMsg, util.KeySyncWith)
+		return nil, false
+	}
+	if err == helpers.ErrUnknownTenant {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.UnknownTenantMsg, util.KeyProfileID)
+		return nil, false
+	}
+	if err != nil {
+		appkit.GetContextLogger(appCtx.Logger, req).Crit(err.Error())
+		util.RenderAPIErrorJSON(appCtx, w)
+		return nil, false
+	}
+	return connector, true
 }
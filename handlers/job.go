@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/helpers"
+	"github.com/paypermint/bridge-app-svc/models"
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+//GetJob renders the status of a sync job
+func GetJob(w http.ResponseWriter, req *http.Request) {
+	job, err := jobManager.Get(util.ProfileIDFromHTTPRequest(req), mux.Vars(req)["id"])
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusNotFound, util.JobNotFoundMsg, "id")
+		return
+	}
+	util.RenderJSON(appCtx, w, http.StatusOK, job.ToAPIResponse())
+}
+
+//CancelJob cancels a queued or running sync job
+func CancelJob(w http.ResponseWriter, req *http.Request) {
+	job, err := jobManager.Cancel(util.ProfileIDFromHTTPRequest(req), mux.Vars(req)["id"])
+	switch err {
+	case nil:
+		util.RenderJSON(appCtx, w, http.StatusOK, job.ToAPIResponse())
+	case helpers.ErrJobNotFound:
+		util.RenderErrorJSON(appCtx, w, http.StatusNotFound, util.JobNotFoundMsg, "id")
+	case helpers.ErrJobFinished:
+		util.RenderErrorJSON(appCtx, w, http.StatusConflict, util.JobFinishedMsg, "id")
+	default:
+		appkit.GetContextLogger(appCtx.Logger, req).Crit(err.Error())
+		util.RenderAPIErrorJSON(appCtx, w)
+	}
+}
+
+//GetJobReport downloads the per row report of a customer sync job as CSV
+func GetJobReport(w http.ResponseWriter, req *http.Request) {
+	ctxLogger := appkit.GetContextLogger(appCtx.Logger, req)
+
+	params, _, _ := helpers.GetRequestParams(req, "GET")
+	if field, ok := helpers.HasUnsupportedParameters(params, util.KeyStatus); ok {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.UnsupportedParamMsg, field)
+		return
+	}
+
+	//optional
+	status, err := helpers.GetOptionalStringParam(params, util.KeyStatus)
+	if err != nil || (status != helpers.EmptyString && !helpers.IsCustomerSyncStatus(status)) {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidParameterMsg, util.KeyStatus)
+		return
+	}
+
+	job, err := jobManager.Get(util.ProfileIDFromHTTPRequest(req), mux.Vars(req)["id"])
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusNotFound, util.JobNotFoundMsg, "id")
+		return
+	}
+	report, ok := job.Result().(*models.CustomerSyncReport)
+	if !ok {
+		util.RenderErrorJSON(appCtx, w, http.StatusNotFound, util.JobReportNotFoundMsg, "id")
+		return
+	}
+
+	w.Header().Set(util.KeyContentType, "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", job.ID()+".csv"))
+	w.WriteHeader(http.StatusOK)
+	if err := helpers.WriteCustomerSyncReportCSV(w, report, status); err != nil {
+		ctxLogger.Error("unable to write job report", "error_message", err.Error())
+	}
+}
+
+// renderJobAccepted renders the outcome of submitting a job
+func renderJobAccepted(w http.ResponseWriter, req *http.Request, job *helpers.Job, err error) {
+	if err == helpers.ErrJobQueueFull {
+		util.RenderGatewayErrorJSON(appCtx, w, http.StatusServiceUnavailable, util.JobQueueFullMsg)
+		return
+	}
+	if err != nil {
+		appkit.GetContextLogger(appCtx.Logger, req).Crit(err.Error())
+		util.RenderAPIErrorJSON(appCtx, w)
+		return
+	}
+	w.Header().Set("Location", "/bridgeapp/v1/jobs/"+job.ID())
+	util.RenderJSON(appCtx, w, http.StatusAccepted, job.ToAPIResponse())
+}
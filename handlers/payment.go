@@ -21,7 +21,7 @@ func SyncPayments(w http.ResponseWriter, req *http.Request) {
 		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), field)
 		return
 	}
-	if field, ok := helpers.HasUnsupportedInterfaceParameters(params, util.KeyRecords, field); ok {
+	if field, ok := helpers.HasUnsupportedInterfaceParameters(params, util.KeyRecords, util.KeyDryRun, util.KeyForce, field); ok {
 		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.UnsupportedParamMsg, field)
 		return
 	}
@@ -33,36 +33,57 @@ func SyncPayments(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	ctxLogger.Info("recordItems: ", "message", recordItems)
-
-	traceID := appkit.TraceIDFromHTTPRequest(req)
-	vClient, err := appkit.VaultConnect(appCtx, traceID)
+	dryRun, err := helpers.GetOptionalBoolInterfaceParam(params, util.KeyDryRun)
 	if err != nil {
-		ctxLogger.Crit(err.Error())
-		util.RenderAPIErrorJSON(appCtx, w)
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyDryRun)
+		return
+	}
+	//optional, reposts records which have been posted before
+	force, err := helpers.GetOptionalBoolInterfaceParam(params, util.KeyForce)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyForce)
 		return
 	}
 
-	// sap user credentials from vault
-	userid, password, fetchErr := vClient.SAPClientCreds(helpers.GetSapUserCredsPath())
-	if fetchErr != nil {
-		ctxLogger.Crit(fetchErr.Error())
-		util.RenderAPIErrorJSON(appCtx, w)
+	ctxLogger.Info("Payment records received", "count", len(recordItems))
+
+	// payments were always posted to SAP before sync_with was introduced
+	syncWith := req.Header.Get(util.KeySyncWith)
+	if syncWith == helpers.EmptyString {
+		syncWith = util.SyncWithSAP
+	}
+	connector, ok := getConnector(w, req, syncWith)
+	if !ok {
 		return
 	}
-	sapClient := helpers.CreateSAPClient(req.RemoteAddr, userid, password)
-	ctxLogger.Info("SAP Client", "message", sapClient)
-	paymentUpdateRequest := &helpers.PostPaymentUpdateRequest{
-		Records: recordItems,
+	if dryRun {
+		preview, err := helpers.PreviewPaymentPostings(connector, util.ProfileIDFromHTTPRequest(req), recordItems, force)
+		if err != nil {
+			ctxLogger.Crit(err.Error())
+			util.RenderAPIErrorJSON(appCtx, w)
+			return
+		}
+		util.RenderJSON(appCtx, w, http.StatusOK, preview)
+		return
 	}
 	platform := req.Header.Get("Platform")
-	response, err := sapClient.PostPaymentUpdateToSAP(paymentUpdateRequest, platform)
-	if err != nil {
+	response, err := helpers.PostPaymentConfirmations(connector, util.ProfileIDFromHTTPRequest(req), recordItems, platform, force)
+	switch {
+	case err == helpers.ErrCircuitOpen:
+		util.RenderGatewayErrorJSON(appCtx, w, http.StatusServiceUnavailable, util.UpstreamUnavailableMsg)
+		return
+	case err == helpers.ErrPaymentPostingInProgress:
+		util.RenderErrorJSON(appCtx, w, http.StatusConflict, util.PaymentPostingInProgressMsg, util.KeyTransactionRef)
+		return
+	case err != nil && response == nil:
 		ctxLogger.Crit(err.Error())
 		util.RenderAPIErrorJSON(appCtx, w)
 		return
+	case err != nil:
+		// SAP has accepted the records, only recording the posting failed
+		ctxLogger.Error("unable to record payment postings", "error_message", err.Error())
 	}
-	ctxLogger.Info("SAP Response", "message", response)
+	ctxLogger.Info("SAP Response", "code", response.Code)
 
 	util.RenderJSON(appCtx, w, http.StatusOK, response)
 	return
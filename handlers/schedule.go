@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/helpers"
+	"github.com/paypermint/bridge-app-svc/models"
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+const (
+	// defaultScheduleRunCount is the number of runs listed when the request names no count
+	defaultScheduleRunCount = 20
+	maxScheduleRunCount     = 100
+)
+
+//GetSchedules renders the invoice schedules along with their next run
+func GetSchedules(w http.ResponseWriter, req *http.Request) {
+	schedules := scheduler.Schedules()
+	util.RenderJSON(appCtx, w, http.StatusOK, models.List{
+		TotalCount: int64(len(schedules)),
+		Object:     "list",
+		Data:       schedules,
+	})
+}
+
+//GetScheduleRuns renders the latest runs of an invoice schedule, newest first
+func GetScheduleRuns(w http.ResponseWriter, req *http.Request) {
+	params, _, _ := helpers.GetRequestParams(req, "GET")
+	if field, ok := helpers.HasUnsupportedParameters(params, util.KeyCount); ok {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.UnsupportedParamMsg, field)
+		return
+	}
+	count := defaultScheduleRunCount
+	if _, ok := params[util.KeyCount]; ok {
+		value, err := strconv.Atoi(params[util.KeyCount])
+		if err != nil || value <= 0 || value > maxScheduleRunCount {
+			util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidParameterMsg, util.KeyCount)
+			return
+		}
+		count = value
+	}
+
+	runs, err := scheduler.Runs(mux.Vars(req)["name"], count)
+	switch err {
+	case nil:
+	case helpers.ErrScheduleNotFound:
+		util.RenderErrorJSON(appCtx, w, http.StatusNotFound, util.ScheduleNotFoundMsg, "name")
+		return
+	default:
+		appkit.GetContextLogger(appCtx.Logger, req).Crit(err.Error())
+		util.RenderAPIErrorJSON(appCtx, w)
+		return
+	}
+	data := []*models.ScheduleRun{}
+	for _, run := range runs {
+		data = append(data, run.ToAPIResponse())
+	}
+	util.RenderJSON(appCtx, w, http.StatusOK, models.List{
+		TotalCount: int64(len(data)),
+		Object:     "list",
+		Data:       data,
+	})
+}
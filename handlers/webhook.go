@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/helpers"
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+// maxWebhookSize bounds the payload of a webhook
+const maxWebhookSize = 1 << 20
+
+//POST Operations
+
+//ReceivePayabbhiWebhook posts the payments of payabbhi payment.captured events to SAP, other events are acknowledged.
+//The profile of the webhook is taken from its route, the signature made with the webhook secret of the profile vouches for it
+func ReceivePayabbhiWebhook(w http.ResponseWriter, req *http.Request) {
+	ctxLogger := appkit.GetContextLogger(appCtx.Logger, req)
+	profileID := mux.Vars(req)["profile_id"]
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookSize))
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidParameterMsg, helpers.EmptyString)
+		return
+	}
+	if err := helpers.VerifyWebhookSignature(profileID, payload, req.Header.Get(util.KeyPayabbhiSignature)); err != nil {
+		ctxLogger.Warn("rejected payabbhi webhook", "profile_id", profileID, "error_message", err.Error())
+		util.RenderErrorJSON(appCtx, w, http.StatusUnauthorized, util.InvalidWebhookSignatureMsg, util.KeyPayabbhiSignature)
+		return
+	}
+	// webhooks carry no Profile-Id, the connector is created for the profile of the route
+	req.Header.Set(util.KeyProfileID, profileID)
+
+	event, err := helpers.ParseWebhookEvent(payload)
+	if err != nil {
+		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.InvalidPostParameterMsg, util.KeyType)
+		return
+	}
+	ctxLogger.Info("inside ReceivePayabbhiWebhook", "event_id", event.ID, "type", event.Type)
+
+	if !helpers.IsPaymentWebhookEvent(event.Type) {
+		util.RenderJSON(appCtx, w, http.StatusOK, helpers.NewWebhookEventResult(event, helpers.WebhookEventStatusIgnored, nil))
+		return
+	}
+	records, err := helpers.WebhookPaymentRecords(profileID, event)
+	if err != nil {
+		ctxLogger.Crit(err.Error())
+		util.RenderAPIErrorJSON(appCtx, w)
+		return
+	}
+	if len(records) == 0 {
+		ctxLogger.Info("payment is not for an invoice synced from SAP", "event_id", event.ID)
+		util.RenderJSON(appCtx, w, http.StatusOK, helpers.NewWebhookEventResult(event, helpers.WebhookEventStatusIgnored, nil))
+		return
+	}
+
+	connector, ok := getConnector(w, req, util.SyncWithSAP)
+	if !ok {
+		return
+	}
+	// a failed posting is answered with an error so that payabbhi delivers the event again
+	response, err := helpers.PostPaymentConfirmations(connector, profileID, records, req.Header.Get("Platform"), false)
+	switch {
+	case err == helpers.ErrCircuitOpen:
+		util.RenderGatewayErrorJSON(appCtx, w, http.StatusServiceUnavailable, util.UpstreamUnavailableMsg)
+		return
+	case err == helpers.ErrPaymentPostingInProgress:
+		util.RenderErrorJSON(appCtx, w, http.StatusConflict, util.PaymentPostingInProgressMsg, util.KeyTransactionRef)
+		return
+	case err != nil && response == nil:
+		ctxLogger.Crit(err.Error())
+		util.RenderAPIErrorJSON(appCtx, w)
+		return
+	case err != nil:
+		// SAP has accepted the records, only recording the posting failed
+		ctxLogger.Error("unable to record payment postings", "error_message", err.Error())
+	}
+
+	util.RenderJSON(appCtx, w, http.StatusOK, helpers.NewWebhookEventResult(event, helpers.WebhookEventStatusPosted, response))
+}
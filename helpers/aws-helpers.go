@@ -1,10 +1,13 @@
 package helpers
 
 import (
-	"bytes"
-	"encoding/csv"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -12,53 +15,136 @@ import (
 	"github.com/paypermint/appkit"
 )
 
-// GetS3File gets the file in given path
-func GetS3File(ctxlogger appkit.AppLogger, bucketname, buckettag, fileCategory, fileName, prefix string) ([][]string, error) {
+const s3Scheme = "s3"
+
+//ErrInvalidS3URL is returned for a source which is not of the form s3://bucket/key
+var ErrInvalidS3URL = errors.New("invalid s3 url")
+
+//S3Object identifies an object in a bucket
+type S3Object struct {
+	Bucket string
+	Key    string
+	ETag   string
+}
+
+//ParseS3URL splits an s3://bucket/key url. A key ending with / is a prefix
+func ParseS3URL(source string) (string, string, error) {
+	u, err := url.Parse(source)
+	if err != nil || u.Scheme != s3Scheme || u.Host == EmptyString {
+		return EmptyString, EmptyString, ErrInvalidS3URL
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if key == EmptyString {
+		return EmptyString, EmptyString, ErrInvalidS3URL
+	}
+	return u.Host, key, nil
+}
+
+//IsS3Prefix returns true if the key of an s3 url denotes a prefix rather than an object
+func IsS3Prefix(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+func newS3Client() (*s3.S3, error) {
 	// Initialize a session that the SDK will use to load
 	// credentials from the shared credentials file ~/.aws/credentials.
-	ctxlogger.Info("Establishing connection with aws")
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(bucketRegion)},
-	)
+	config := &aws.Config{
+		Region: aws.String(bucketRegion),
+	}
+	if bucketEndpoint != EmptyString {
+		// S3 compatible stores such as MinIO
+		config.Endpoint = aws.String(bucketEndpoint)
+		config.S3ForcePathStyle = aws.Bool(bucketPathStyle)
+	}
+	sess, err := session.NewSession(config)
 	if err != nil {
-		ctxlogger.Error("Unable to establish connection with aws : %v", err)
 		return nil, err
 	}
-	ctxlogger.Info("Connection to aws established")
-
-	ctxlogger.Info("S3 Client initialization")
-	// S3 service client
-	svc := s3.New(sess)
+	return s3.New(sess), nil
+}
 
-	input := &s3.GetObjectInput{
-		Bucket: aws.String(bucketname),
-		Key:    aws.String(fileName),
+//OpenS3Object returns a reader streaming the content of an object
+func OpenS3Object(ctx context.Context, object *S3Object) (io.ReadCloser, error) {
+	svc, err := newS3Client()
+	if err != nil {
+		return nil, err
 	}
-	ctxlogger.Info("S3 Client initialized")
+	response, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(object.Bucket),
+		Key:    aws.String(object.Key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get file %q from %q: %v", object.Key, object.Bucket, err)
+	}
+	object.ETag = aws.StringValue(response.ETag)
+	return response.Body, nil
+}
 
-	ctxlogger.Info("Started request for GetCSVFile from S3")
-	response, err := svc.GetObject(input)
+//ListNewS3Objects returns the objects under a prefix which have not been synced in their current version
+func ListNewS3Objects(ctx context.Context, bucket, prefix string) ([]*S3Object, error) {
+	svc, err := newS3Client()
 	if err != nil {
-		ctxlogger.Error(fmt.Sprintf("Unable to get file %q from %q, %v", fileName, bucketname, err))
 		return nil, err
 	}
-
-	body, err := ioutil.ReadAll(response.Body)
+	objects := []*S3Object{}
+	var storeErr error
+	err = svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, content := range page.Contents {
+			key := aws.StringValue(content.Key)
+			if IsS3Prefix(key) || aws.Int64Value(content.Size) == 0 {
+				continue
+			}
+			object := &S3Object{Bucket: bucket, Key: key, ETag: aws.StringValue(content.ETag)}
+			synced, err := GetStore().GetSyncedObject(bucket, key)
+			if err != nil && err != ErrNotFound {
+				storeErr = err
+				return false
+			}
+			if synced == nil || synced.ETag != object.ETag {
+				objects = append(objects, object)
+			}
+		}
+		return true
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error in reading file %s: %s\n", fileName, err)
+		return nil, err
+	}
+	if storeErr != nil {
+		return nil, storeErr
 	}
+	return objects, nil
+}
 
-	data := make([][]string, 0)
-	reader := csv.NewReader(bytes.NewBuffer(body))
-	records, err := reader.ReadAll()
+// GetS3File reads the records of an object, streaming the object body through the record iterator
+func GetS3File(ctx context.Context, ctxlogger appkit.AppLogger, object *S3Object) ([][]string, error) {
+	ctxlogger.Info("Started request for GetCSVFile from S3", "bucket", object.Bucket, "key", object.Key)
+	body, err := OpenS3Object(ctx, object)
 	if err != nil {
-		fmt.Println("Error", err)
+		ctxlogger.Error(err.Error())
+		return nil, err
 	}
-
-	for value, record := range records { // for i:=0; i<len(record)
-		data = append(data, record)
-		fmt.Println("", records[value])
+	records, err := NewRecordIterator(body, EmptyString)
+	if err != nil {
+		return nil, err
 	}
+	defer records.Close()
 
+	data, err := readAllRecords(records)
+	if err != nil {
+		return nil, fmt.Errorf("error in reading file %s: %s", object.Key, err)
+	}
 	return data, nil
 }
+
+//MarkS3ObjectSynced records that the current version of an object has been synced
+func MarkS3ObjectSynced(object *S3Object) error {
+	return GetStore().SaveSyncedObject(&SyncedObject{
+		Bucket:   object.Bucket,
+		Key:      object.Key,
+		ETag:     object.ETag,
+		SyncedAt: time.Now(),
+	})
+}
@@ -0,0 +1,152 @@
+package helpers
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paypermint/bridge-app-svc/models"
+)
+
+//Circuit breaker states
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
+)
+
+//Upstreams guarded by a circuit breaker
+const (
+	UpstreamPayabbhi = "payabbhi"
+	UpstreamSAP      = "sap"
+)
+
+const (
+	circuitBreakerObject = "circuit_breaker"
+)
+
+//ErrCircuitOpen is returned without calling the upstream while its circuit breaker is open
+var ErrCircuitOpen = errors.New("upstream unavailable, circuit breaker is open")
+
+var (
+	breakerThreshold   = 5
+	breakerOpenTimeout = 30 * time.Second
+
+	circuitBreakersMu sync.Mutex
+	circuitBreakers   = map[string]*CircuitBreaker{}
+)
+
+func init() {
+	// the state of the known upstreams is reported before they are first called
+	GetCircuitBreaker(UpstreamPayabbhi)
+	GetCircuitBreaker(UpstreamSAP)
+}
+
+//SetCircuitBreakerConfig sets the number of consecutive failures opening a circuit breaker and the duration it
+//stays open before a trial request is let through
+func SetCircuitBreakerConfig(threshold int, openTimeout time.Duration) {
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+	breakerThreshold = threshold
+	breakerOpenTimeout = openTimeout
+}
+
+//CircuitBreaker fails calls to an upstream fast once consecutive calls have failed
+type CircuitBreaker struct {
+	name string
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	// trial is true while the single request of the half open state is in flight
+	trial bool
+}
+
+//GetCircuitBreaker returns the circuit breaker of an upstream, creating it on first use
+func GetCircuitBreaker(upstream string) *CircuitBreaker {
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+	breaker, ok := circuitBreakers[upstream]
+	if !ok {
+		breaker = &CircuitBreaker{name: upstream, state: CircuitStateClosed}
+		circuitBreakers[upstream] = breaker
+	}
+	return breaker
+}
+
+//GetCircuitBreakers returns the circuit breakers of all upstreams, ordered by name
+func GetCircuitBreakers() []*CircuitBreaker {
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+	breakers := make([]*CircuitBreaker, 0, len(circuitBreakers))
+	for _, breaker := range circuitBreakers {
+		breakers = append(breakers, breaker)
+	}
+	sort.Slice(breakers, func(i, j int) bool { return breakers[i].name < breakers[j].name })
+	return breakers
+}
+
+func getCircuitBreakerConfig() (int, time.Duration) {
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+	return breakerThreshold, breakerOpenTimeout
+}
+
+//Allow returns ErrCircuitOpen if a call to the upstream must not be made. Once the open timeout has passed a single
+//trial call is allowed, its outcome closes or opens the breaker again
+func (b *CircuitBreaker) Allow() error {
+	_, openTimeout := getCircuitBreakerConfig()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitStateOpen:
+		if time.Since(b.openedAt) < openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = CircuitStateHalfOpen
+		b.trial = true
+		return nil
+	case CircuitStateHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+//Record records the outcome of a call allowed by Allow
+func (b *CircuitBreaker) Record(failed bool) {
+	threshold, _ := getCircuitBreakerConfig()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if !failed {
+		b.state = CircuitStateClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == CircuitStateHalfOpen || b.failures >= threshold {
+		b.state = CircuitStateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+//ToAPIResponse returns the API structure of the circuit breaker state
+func (b *CircuitBreaker) ToAPIResponse() *models.CircuitBreaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	response := &models.CircuitBreaker{
+		Object:              circuitBreakerObject,
+		Upstream:            b.name,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != CircuitStateClosed {
+		response.OpenedAt = b.openedAt.Unix()
+	}
+	return response
+}
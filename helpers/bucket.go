@@ -1,8 +1,14 @@
 package helpers
 
-var bucketRegion string
+var (
+	bucketRegion    string
+	bucketEndpoint  string
+	bucketPathStyle bool
+)
 
-func SetBucketConfig(region string) {
+//SetBucketConfig sets the region of the bucket and, for S3 compatible stores, the endpoint to use instead of AWS
+func SetBucketConfig(region, endpoint string, pathStyle bool) {
 	bucketRegion = region
-
+	bucketEndpoint = endpoint
+	bucketPathStyle = pathStyle
 }
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -8,6 +9,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/paypermint/bridge-app-svc/models"
 )
 
 // Client .
@@ -16,7 +19,12 @@ type Client struct {
 	tokenAuthCreds *BearerAuthCreds
 	baseURL        string
 	remoteAddr     string
-	HTTPClient     *http.Client
+	ctx            context.Context
+	// upstream names the circuit breaker guarding the requests of the client
+	upstream string
+	// sapEndpoints are the PI RESTAdapter endpoints of a SAP client
+	sapEndpoints SAPEndpoints
+	HTTPClient   *http.Client
 }
 
 //BasicAuthCreds .
@@ -41,32 +49,69 @@ func NewClient(basicAuthCreds *BasicAuthCreds, bearerTokenCreds *BearerAuthCreds
 		},
 		baseURL:    fmt.Sprintf("https://%s/api/v1", GetDynamicHost()),
 		remoteAddr: remoteAddr,
+		upstream:   UpstreamPayabbhi,
 	}
 }
 
-// CreateSAPClient creates new SAP Client with given username and password
-func CreateSAPClient(remoteAddr, userid, password string) *Client {
+// CreateSAPClient creates new SAP Client for the SAP system of profile with given username and password
+func CreateSAPClient(profile *SAPProfile, remoteAddr, userid, password string) *Client {
 	return &Client{
 		basicAuthCreds: &BasicAuthCreds{
 			accessID:  userid,
 			secretKey: password,
 		},
 		HTTPClient: &http.Client{
-			Timeout: 5 * time.Minute,
+			Timeout: profile.timeout,
 		},
-		baseURL:    fmt.Sprintf("http://%s", GetSapURL()),
-		remoteAddr: remoteAddr,
+		baseURL:      profile.baseURL(),
+		remoteAddr:   remoteAddr,
+		upstream:     profile.upstream,
+		sapEndpoints: profile.Endpoints,
 	}
 }
 
+// WithContext returns a copy of the client whose requests are bound to ctx
+func (c *Client) WithContext(ctx context.Context) *Client {
+	client := *c
+	client.ctx = ctx
+	return &client
+}
+
+// withContext binds the request to the client context, a request marked idempotent stays marked
+func (c *Client) withContext(req *http.Request) *http.Request {
+	if c.ctx == nil {
+		return req
+	}
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	req = req.WithContext(c.ctx)
+	if marked {
+		req = markIdempotent(req)
+	}
+	return req
+}
+
 type ErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int                      `json:"code"`
+	Message string                   `json:"message"`
+	Error   *models.APIBusinessError `json:"error,omitempty"`
+}
+
+//APIError is returned when payabbhi rejects a request
+type APIError struct {
+	StatusCode int
+	Message    string
+	Field      string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
 }
 
 type SAPSuccessResponse struct {
 	Code int         `json:"code"`
 	Data interface{} `json:"data"`
+	// Duplicates lists the records of a payment submission which were not posted as they repeat an earlier record
+	Duplicates []*models.PaymentDuplicate `json:"duplicates,omitempty"`
 }
 
 // Content-type and body should be already added to req
@@ -83,11 +128,16 @@ func (c *Client) sendRequestToPayabbhi(req *http.Request, v interface{}) error {
 		// req.Header.Add("env", c.tokenAuthCreds.environment)
 	}
 	req.RemoteAddr = ""
+	// the request is aborted along with the job or request it is made for, retries included
+	req = c.withContext(req)
 
-	res, err := c.HTTPClient.Do(req)
+	req, span := c.startSpan(req)
+	res, err := c.do(req)
 	if err != nil {
+		EndSpan(span, 0, err)
 		return err
 	}
+	defer EndSpan(span, res.StatusCode, nil)
 
 	defer res.Body.Close()
 
@@ -95,7 +145,14 @@ func (c *Client) sendRequestToPayabbhi(req *http.Request, v interface{}) error {
 	if res.StatusCode != http.StatusOK {
 		var errRes ErrorResponse
 		if err = json.NewDecoder(res.Body).Decode(&errRes); err == nil {
-			return errors.New(errRes.Message)
+			apiErr := &APIError{StatusCode: res.StatusCode, Message: errRes.Message}
+			if errRes.Error != nil {
+				apiErr.Message = errRes.Error.Message
+				apiErr.Field = errRes.Error.Field
+			}
+			if apiErr.Message != EmptyString {
+				return apiErr
+			}
 		}
 
 		return fmt.Errorf("unknown error, status code: %d", res.StatusCode)
@@ -119,11 +176,16 @@ func (c *Client) sendRequestToSAP(req *http.Request, v interface{}) (*SAPSuccess
 		req.SetBasicAuth(c.basicAuthCreds.accessID, c.basicAuthCreds.secretKey)
 	}
 	req.RemoteAddr = ""
+	// the request is aborted along with the job or request it is made for, retries included
+	req = c.withContext(req)
 
-	res, err := c.HTTPClient.Do(req)
+	req, span := c.startSpan(req)
+	res, err := c.do(req)
 	if err != nil {
+		EndSpan(span, 0, err)
 		return nil, err
 	}
+	defer EndSpan(span, res.StatusCode, nil)
 
 	defer res.Body.Close()
 
@@ -144,6 +206,7 @@ func (c *Client) sendRequestToSAP(req *http.Request, v interface{}) (*SAPSuccess
 	if err = json.NewDecoder(res.Body).Decode(&fullResponse.Data); err != nil {
 		return nil, err
 	}
+	recordSAPMessageID(span, res.Header, fullResponse.Data)
 
 	return &fullResponse, nil
 }
@@ -0,0 +1,96 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+//ErrUnknownConnector is returned when no connector is registered for a sync_with value
+var ErrUnknownConnector = errors.New("unknown connector")
+
+//ErrOperationNotSupported is returned by a connector for an operation its ERP does not offer
+var ErrOperationNotSupported = errors.New("operation not supported by connector")
+
+//AllCustomers asks FetchOpenItems for the open items of every customer, the SAP RESTAdapter takes it as wildcard
+const AllCustomers = "*"
+
+//ConnectorRecord represents a single record as exchanged with an ERP system
+type ConnectorRecord map[string]interface{}
+
+//Connector is implemented by every ERP system the bridge can sync with
+type Connector interface {
+	// Name returns the sync_with value the connector is registered under
+	Name() string
+	// FetchOpenItems returns the open items of the given customer
+	FetchOpenItems(merchantCustomerID string) ([]ConnectorRecord, error)
+	// PostPaymentConfirmations posts payment confirmations for the given records
+	PostPaymentConfirmations(records []*SapRecord, platform string) (*SAPSuccessResponse, error)
+	// PaymentConfirmationsPayload returns the request PostPaymentConfirmations sends for the given records
+	PaymentConfirmationsPayload(records []*SapRecord) interface{}
+}
+
+//ConnectorOptions carries the request scoped values a connector is created with
+type ConnectorOptions struct {
+	Context context.Context
+	AppCtx  *appkit.AppContext
+	TraceID string
+	// ProfileID selects the ERP system of the merchant
+	ProfileID  string
+	RemoteAddr string
+}
+
+//ConnectorFactory creates a connector for a single sync
+type ConnectorFactory func(opts *ConnectorOptions) (Connector, error)
+
+var (
+	connectorsMu sync.RWMutex
+	connectors   = map[string]ConnectorFactory{}
+)
+
+//RegisterConnector makes a connector available under the given sync_with value
+func RegisterConnector(syncWith string, factory ConnectorFactory) {
+	connectorsMu.Lock()
+	defer connectorsMu.Unlock()
+	if factory == nil {
+		panic("helpers: RegisterConnector factory is nil")
+	}
+	if _, dup := connectors[syncWith]; dup {
+		panic("helpers: RegisterConnector called twice for " + syncWith)
+	}
+	connectors[syncWith] = factory
+}
+
+//HasConnector returns true if a connector is registered for the given sync_with value
+func HasConnector(syncWith string) bool {
+	connectorsMu.RLock()
+	defer connectorsMu.RUnlock()
+	_, ok := connectors[syncWith]
+	return ok
+}
+
+//GetConnector creates the connector registered for the given sync_with value
+func GetConnector(syncWith string, opts *ConnectorOptions) (Connector, error) {
+	connectorsMu.RLock()
+	factory, ok := connectors[syncWith]
+	connectorsMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownConnector
+	}
+	return factory(opts)
+}
+
+//NewConnectorOptions returns the connector options for an incoming request, bound to the request context
+func NewConnectorOptions(appCtx *appkit.AppContext, req *http.Request) *ConnectorOptions {
+	return &ConnectorOptions{
+		Context:    req.Context(),
+		AppCtx:     appCtx,
+		TraceID:    appkit.TraceIDFromHTTPRequest(req),
+		ProfileID:  util.ProfileIDFromHTTPRequest(req),
+		RemoteAddr: req.RemoteAddr,
+	}
+}
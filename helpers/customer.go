@@ -2,9 +2,36 @@ package helpers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/models"
+)
+
+const (
+	customerSyncReportObject = "customer_sync_report"
+)
+
+//Customer sync row statuses
+const (
+	CustomerSyncStatusCreated   = "created"
+	CustomerSyncStatusUpdated   = "updated"
+	CustomerSyncStatusUnchanged = "unchanged"
+	// CustomerSyncStatusDeactivatedLocally is given to blocked or removed customers, the bridge stops pulling their
+	// invoices but they stay active at payabbhi
+	CustomerSyncStatusDeactivatedLocally = "deactivated_locally"
+	// CustomerSyncStatusSkipped is given to blocked customers which have never been synced, they are not created
+	CustomerSyncStatusSkipped = "skipped"
+	CustomerSyncStatusFailed  = "failed"
 )
 
 //CreateCustomerRequest represents struct to create customer
@@ -43,17 +70,436 @@ type BankDetail struct {
 	BeneficiaryName string `json:"beneficiary_name,omitempty"`
 }
 
+//Customer represents the payabbhi customer returned by the customers api
+type Customer struct {
+	ID                 string `json:"id"`
+	MerchantCustomerID string `json:"merchant_customer_id,omitempty"`
+}
+
 // CreateCustomer calls payabbhi api for creating customer
-func (c *Client) CreateCustomer(createCustomerRequest *CreateCustomerRequest) error {
+func (c *Client) CreateCustomer(createCustomerRequest *CreateCustomerRequest) (*Customer, error) {
 	jsonValue, _ := json.Marshal(createCustomerRequest)
 	req, err := http.NewRequest("POST", fmt.Sprintf("%s/customers", c.baseURL), bytes.NewBuffer(jsonValue))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	if err := c.sendRequestToPayabbhi(req, nil); err != nil {
-		return err
+	customer := &Customer{}
+	if err := c.sendRequestToPayabbhi(req, customer); err != nil {
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+// UpdateCustomer calls payabbhi api for updating a customer, the customer is replaced by the fields of the request
+func (c *Client) UpdateCustomer(customerID string, createCustomerRequest *CreateCustomerRequest) (*Customer, error) {
+	jsonValue, _ := json.Marshal(createCustomerRequest)
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/customers/%s", c.baseURL, url.PathEscape(customerID)), bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// the customer ends up with the same fields however often the request is repeated
+	req = markIdempotent(req)
+	customer := &Customer{}
+	if err := c.sendRequestToPayabbhi(req, customer); err != nil {
+		return nil, err
 	}
 
+	return customer, nil
+}
+
+//CustomerSyncRequest holds what a customer sync needs once the originating request has completed
+type CustomerSyncRequest struct {
+	ProfileID string
+	Client    *Client
+	// DryRun maps and validates the rows without creating or updating customers, the rows carry the payload instead
+	DryRun bool
+	// DeactivateMissing deactivates the synced customers which have no row in the customer file, the file then
+	// has to hold every customer of the profile
+	DeactivateMissing bool
+	Logger            appkit.AppLogger
+}
+
+// SyncCustomersJob returns the job upserting a payabbhi customer for every data row of a customer file, the
+// header row has already been read by the mapper. Customers synced earlier are updated when a mapped field changed,
+// blocked customers are deactivated and rows which can not be parsed are reported as failed. The job result is
+// the per row report
+func SyncCustomersJob(syncReq *CustomerSyncRequest, mapper *CustomerMapper, records *RecordIterator) JobFunc {
+	return func(ctx context.Context, job *Job) (interface{}, error) {
+		defer records.Close()
+		client := syncReq.Client.WithContext(ctx)
+		report := &models.CustomerSyncReport{
+			Object: customerSyncReportObject,
+			DryRun: syncReq.DryRun,
+			Rows:   []*models.CustomerSyncResult{},
+		}
+		// merchant customer ids of the file, complete unless a row could not be read
+		seen, complete := map[string]bool{}, true
+		for {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			customerData, row, err := records.Next()
+			if err == io.EOF {
+				break
+			}
+			rowErr, isRowErr := err.(*RowError)
+			if err != nil && !isRowErr {
+				return report, err
+			}
+			job.AddTotal(1)
+
+			var result *models.CustomerSyncResult
+			if isRowErr {
+				complete = false
+				result = failCustomerSyncResult(&models.CustomerSyncResult{Row: row}, rowErr.Err)
+			} else {
+				seen[mapper.MerchantCustomerID(customerData)] = true
+				result = syncCustomer(client, syncReq, mapper, row, customerData)
+			}
+			recordCustomerSyncResult(syncReq, job, report, strconv.Itoa(result.Row), result)
+		}
+
+		if syncReq.DeactivateMissing {
+			if !complete {
+				// a customer of an unreadable row would be taken for removed
+				syncReq.Logger.Warn("customers missing from the file are not deactivated, some rows could not be read")
+				return report, nil
+			}
+			return report, deactivateMissingCustomers(ctx, syncReq, job, report, seen)
+		}
+		return report, nil
+	}
+}
+
+// deactivateMissingCustomers deactivates the active customers synced for the profile which are not in the file
+func deactivateMissingCustomers(ctx context.Context, syncReq *CustomerSyncRequest, job *Job, report *models.CustomerSyncReport, seen map[string]bool) error {
+	customers, err := GetStore().ListCustomers(syncReq.ProfileID)
+	if err != nil {
+		return err
+	}
+	for _, synced := range customers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if seen[synced.MerchantCustomerID] || synced.Deactivated {
+			continue
+		}
+		job.AddTotal(1)
+		result := &models.CustomerSyncResult{
+			MerchantCustomerID: synced.MerchantCustomerID,
+			CustomerID:         synced.CustomerID,
+		}
+		deactivateCustomer(syncReq, synced, result)
+		recordCustomerSyncResult(syncReq, job, report, synced.MerchantCustomerID, result)
+	}
 	return nil
 }
+
+// recordCustomerSyncResult adds the outcome of a customer to the report and the job progress, key identifies the
+// customer in the failures of the job
+func recordCustomerSyncResult(syncReq *CustomerSyncRequest, job *Job, report *models.CustomerSyncReport, key string, result *models.CustomerSyncResult) {
+	addCustomerSyncResult(report, result)
+	if !syncReq.DryRun {
+		countSynced(customerConnector, MetricObjectCustomer, result.Status, 1)
+	}
+	if result.Status == CustomerSyncStatusFailed {
+		syncReq.Logger.Error(result.Message, "row", result.Row, "merchant_customer_id", result.MerchantCustomerID)
+		job.RecordFailed(key, result.Field, errors.New(result.Message))
+		return
+	}
+	job.RecordProcessed()
+}
+
+// SyncS3CustomersJob returns the job syncing the customers of a bucket object, the object is recorded as synced once done.
+// sheet selects the sheet of a workbook object
+func SyncS3CustomersJob(syncReq *CustomerSyncRequest, mappingProfile *MappingProfile, sheet string, object *S3Object) JobFunc {
+	return func(ctx context.Context, job *Job) (interface{}, error) {
+		syncReq.Logger.Info("Started request for customer file from S3", "bucket", object.Bucket, "key", object.Key)
+		body, err := OpenS3Object(ctx, object)
+		if err != nil {
+			return nil, err
+		}
+		records, err := NewRecordIterator(body, sheet)
+		if err != nil {
+			return nil, err
+		}
+		mapper, err := mappingProfile.ReadCustomerMapper(records)
+		if err != nil {
+			records.Close()
+			return nil, err
+		}
+		report, err := SyncCustomersJob(syncReq, mapper, records)(ctx, job)
+		if err != nil || syncReq.DryRun {
+			return report, err
+		}
+		if err := MarkS3ObjectSynced(object); err != nil {
+			syncReq.Logger.Error("unable to record synced object", "bucket", object.Bucket, "key", object.Key, "error_message", err.Error())
+		}
+		return report, nil
+	}
+}
+
+// syncCustomer upserts the customer of a single row by its merchant_customer_id. A customer synced earlier is
+// updated when the fields mapped from the row changed, or deactivated when the row flags it as blocked.
+// A dry run stops short of writing to payabbhi and reports the request or the diff instead
+func syncCustomer(client *Client, syncReq *CustomerSyncRequest, mapper *CustomerMapper, row int, customerData []string) *models.CustomerSyncResult {
+	result := &models.CustomerSyncResult{
+		Row:                row,
+		MerchantCustomerID: mapper.MerchantCustomerID(customerData),
+	}
+	createCustomerRequest, field, err := mapper.ToCreateCustomerRequest(customerData)
+	if err != nil {
+		failCustomerSyncResult(result, err)
+		result.Field = field
+		return result
+	}
+	blocked, err := mapper.IsBlocked(customerData)
+	if err != nil {
+		failCustomerSyncResult(result, err)
+		result.Field = CustomerFieldBlocked
+		return result
+	}
+
+	existing, err := getSyncedCustomer(syncReq.ProfileID, createCustomerRequest.MerchantCustomerID)
+	if err != nil {
+		return failCustomerSyncResult(result, err)
+	}
+	switch {
+	case existing == nil && blocked:
+		result.Status = CustomerSyncStatusSkipped
+		result.Message = "customer is blocked in the ERP"
+	case existing == nil:
+		createCustomer(client, syncReq, createCustomerRequest, result)
+	case blocked:
+		result.CustomerID = existing.CustomerID
+		if existing.Deactivated {
+			result.Status = CustomerSyncStatusUnchanged
+			return result
+		}
+		deactivateCustomer(syncReq, existing, result)
+	default:
+		result.CustomerID = existing.CustomerID
+		updateCustomer(client, syncReq, mapper, existing, createCustomerRequest, result)
+	}
+	return result
+}
+
+func createCustomer(client *Client, syncReq *CustomerSyncRequest, createCustomerRequest *CreateCustomerRequest, result *models.CustomerSyncResult) {
+	if syncReq.DryRun {
+		result.Status = CustomerSyncStatusCreated
+		result.Payload = createCustomerRequest
+		return
+	}
+	customer, err := client.CreateCustomer(createCustomerRequest)
+	if err != nil {
+		failCustomerSyncResult(result, err)
+		return
+	}
+	result.Status = CustomerSyncStatusCreated
+	result.CustomerID = customer.ID
+	if err := saveSyncedCustomer(syncReq.ProfileID, createCustomerRequest, customer.ID, false); err != nil {
+		result.Message = "unable to record synced customer: " + err.Error()
+	}
+}
+
+// updateCustomer updates a customer whose mapped fields differ from the payload it was last synced with. The
+// customers api replaces a customer, the request is the payload last synced with the mapped fields of the row, so
+// that fields the profile does not map are kept. A deactivated customer is activated again, which only concerns
+// the bridge
+func updateCustomer(client *Client, syncReq *CustomerSyncRequest, mapper *CustomerMapper, existing *SyncedCustomer, createCustomerRequest *CreateCustomerRequest, result *models.CustomerSyncResult) {
+	updateCustomerRequest, err := mergeCustomerPayload(existing.Payload, mapper, createCustomerRequest)
+	if err != nil {
+		failCustomerSyncResult(result, err)
+		return
+	}
+	diff, err := diffPayload(existing.Payload, updateCustomerRequest)
+	if err != nil {
+		failCustomerSyncResult(result, err)
+		return
+	}
+	if len(diff) == 0 {
+		result.Status = CustomerSyncStatusUnchanged
+		if existing.Deactivated {
+			result.Message = "customer is activated again"
+			reactivateCustomer(syncReq, existing, result)
+		}
+		return
+	}
+	result.Diff = diff
+	if syncReq.DryRun {
+		result.Status = CustomerSyncStatusUpdated
+		result.Payload = updateCustomerRequest
+		return
+	}
+	if _, err := client.UpdateCustomer(existing.CustomerID, updateCustomerRequest); err != nil {
+		failCustomerSyncResult(result, err)
+		return
+	}
+	result.Status = CustomerSyncStatusUpdated
+	if err := saveSyncedCustomer(syncReq.ProfileID, updateCustomerRequest, existing.CustomerID, false); err != nil {
+		result.Message = "unable to record synced customer: " + err.Error()
+	}
+}
+
+// deactivateCustomer deactivates a customer for the bridge only, payabbhi customers have no status which the
+// customers api sets. The invoices of a deactivated customer are no longer pulled by the invoice schedules
+func deactivateCustomer(syncReq *CustomerSyncRequest, existing *SyncedCustomer, result *models.CustomerSyncResult) {
+	result.Status = CustomerSyncStatusDeactivatedLocally
+	result.Message = "customer stays active at payabbhi, its invoices are no longer pulled"
+	if syncReq.DryRun {
+		return
+	}
+	deactivated := *existing
+	deactivated.Deactivated = true
+	deactivated.SyncedAt = time.Now()
+	if err := GetStore().SaveCustomer(&deactivated); err != nil {
+		failCustomerSyncResult(result, fmt.Errorf("unable to record deactivated customer: %v", err))
+	}
+}
+
+// reactivateCustomer records a deactivated customer, whose row is no longer blocked, as active again
+func reactivateCustomer(syncReq *CustomerSyncRequest, existing *SyncedCustomer, result *models.CustomerSyncResult) {
+	if syncReq.DryRun {
+		return
+	}
+	reactivated := *existing
+	reactivated.Deactivated = false
+	reactivated.SyncedAt = time.Now()
+	if err := GetStore().SaveCustomer(&reactivated); err != nil {
+		failCustomerSyncResult(result, fmt.Errorf("unable to record activated customer: %v", err))
+	}
+}
+
+// mergeCustomerPayload returns the payload a customer was last synced with, with the fields the mapping profile
+// maps set to their value in the row. Fields cleared in the row are removed. The row holds a single bank detail,
+// its fields are set on the first bank detail of the payload
+func mergeCustomerPayload(current string, mapper *CustomerMapper, createCustomerRequest *CreateCustomerRequest) (*CreateCustomerRequest, error) {
+	var currentFields, proposedFields map[string]interface{}
+	if err := json.Unmarshal([]byte(current), &currentFields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(payloadJSON(createCustomerRequest)), &proposedFields); err != nil {
+		return nil, err
+	}
+	if currentFields == nil {
+		currentFields = map[string]interface{}{}
+	}
+	for _, field := range mapper.Fields() {
+		mergeCustomerField(currentFields, proposedFields, strings.Split(field, "."))
+	}
+	merged := &CreateCustomerRequest{}
+	if err := json.Unmarshal([]byte(payloadJSON(currentFields)), merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// mergeCustomerField sets the field at path of current to its value in proposed, or removes it if proposed has none
+func mergeCustomerField(current, proposed map[string]interface{}, path []string) {
+	name := path[0]
+	value, ok := proposed[name]
+	if len(path) == 1 {
+		if ok {
+			current[name] = value
+		} else {
+			delete(current, name)
+		}
+		return
+	}
+
+	currentList, isList := current[name].([]interface{})
+	if _, ok := value.([]interface{}); ok {
+		isList = true
+	}
+	currentObject := firstObject(current[name])
+	if currentObject == nil {
+		currentObject = map[string]interface{}{}
+	}
+	proposedObject := firstObject(value)
+	if proposedObject == nil {
+		proposedObject = map[string]interface{}{}
+	}
+	mergeCustomerField(currentObject, proposedObject, path[1:])
+
+	switch {
+	case !isList && len(currentObject) == 0:
+		delete(current, name)
+	case !isList:
+		current[name] = currentObject
+	case len(currentObject) == 0 && len(currentList) <= 1:
+		delete(current, name)
+	case len(currentObject) == 0:
+		current[name] = currentList[1:]
+	case len(currentList) == 0:
+		current[name] = []interface{}{currentObject}
+	default:
+		currentList[0] = currentObject
+	}
+}
+
+// firstObject returns value as JSON object, or the first element of value if it is an array
+func firstObject(value interface{}) map[string]interface{} {
+	if list, ok := value.([]interface{}); ok && len(list) > 0 {
+		value = list[0]
+	}
+	object, _ := value.(map[string]interface{})
+	return object
+}
+
+func failCustomerSyncResult(result *models.CustomerSyncResult, err error) *models.CustomerSyncResult {
+	result.Status = CustomerSyncStatusFailed
+	result.Message = err.Error()
+	if apiErr, ok := err.(*APIError); ok {
+		result.Field = apiErr.Field
+	}
+	return result
+}
+
+func addCustomerSyncResult(report *models.CustomerSyncReport, result *models.CustomerSyncResult) {
+	switch result.Status {
+	case CustomerSyncStatusCreated:
+		report.Created++
+	case CustomerSyncStatusUpdated:
+		report.Updated++
+	case CustomerSyncStatusUnchanged:
+		report.Unchanged++
+	case CustomerSyncStatusDeactivatedLocally:
+		report.DeactivatedLocally++
+	case CustomerSyncStatusSkipped:
+		report.Skipped++
+	case CustomerSyncStatusFailed:
+		report.Failed++
+	}
+	report.Rows = append(report.Rows, result)
+}
+
+// getSyncedCustomer returns the customer created by an earlier sync, nil if there is none.
+// Rows without a merchant_customer_id can not be tracked and are always created
+func getSyncedCustomer(profileID, merchantCustomerID string) (*SyncedCustomer, error) {
+	if merchantCustomerID == EmptyString {
+		return nil, nil
+	}
+	synced, err := GetStore().GetCustomer(profileID, merchantCustomerID)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	return synced, err
+}
+
+func saveSyncedCustomer(profileID string, createCustomerRequest *CreateCustomerRequest, customerID string, deactivated bool) error {
+	if createCustomerRequest.MerchantCustomerID == EmptyString {
+		return nil
+	}
+	return GetStore().SaveCustomer(&SyncedCustomer{
+		ProfileID:          profileID,
+		MerchantCustomerID: createCustomerRequest.MerchantCustomerID,
+		CustomerID:         customerID,
+		Fingerprint:        fingerprint(createCustomerRequest),
+		Payload:            payloadJSON(createCustomerRequest),
+		Deactivated:        deactivated,
+		SyncedAt:           time.Now(),
+	})
+}
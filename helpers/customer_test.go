@@ -0,0 +1,202 @@
+package helpers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/paypermint/bridge-app-svc/models"
+)
+
+// payabbhiCall is a request received by the fake payabbhi customers api
+type payabbhiCall struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+// fakePayabbhi answers the customers api with customer cust_1 and records the requests it receives
+type fakePayabbhi struct {
+	mu    sync.Mutex
+	calls []payabbhiCall
+}
+
+func newFakePayabbhi(t *testing.T) (*fakePayabbhi, *Client) {
+	fake := &fakePayabbhi{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := payabbhiCall{Method: r.Method, Path: r.URL.Path}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &call.Body)
+		fake.mu.Lock()
+		fake.calls = append(fake.calls, call)
+		fake.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":200,"data":{"id":"cust_1"}}`))
+	}))
+	t.Cleanup(server.Close)
+	return fake, &Client{baseURL: server.URL, upstream: "customer_test", HTTPClient: server.Client()}
+}
+
+// takeCalls returns the requests received since the last call
+func (f *fakePayabbhi) takeCalls() []payabbhiCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+func newTestCustomerMapper(t *testing.T, columns map[string]string, header []string) *CustomerMapper {
+	profile := &MappingProfile{Name: "test", Columns: columns, Required: []string{CustomerFieldMerchantCustomerID}}
+	mapper, err := profile.NewCustomerMapper(header)
+	if err != nil {
+		t.Fatalf("NewCustomerMapper() error = %v", err)
+	}
+	return mapper
+}
+
+var (
+	fullCustomerColumns = map[string]string{
+		CustomerFieldMerchantCustomerID: "id",
+		CustomerFieldName:               "name",
+		CustomerFieldEmail:              "email",
+		CustomerFieldShippingCity:       "shipping_city",
+		CustomerFieldShippingState:      "shipping_state",
+		CustomerFieldBankIfsc:           "ifsc",
+		CustomerFieldBlocked:            "blocked",
+	}
+	fullCustomerHeader = []string{"id", "name", "email", "shipping_city", "shipping_state", "ifsc", "blocked"}
+
+	// contactCustomerColumns map the contact columns of a file which lacks the addresses and bank details
+	contactCustomerColumns = map[string]string{
+		CustomerFieldMerchantCustomerID: "id",
+		CustomerFieldEmail:              "email",
+		CustomerFieldBlocked:            "blocked",
+	}
+	contactCustomerHeader = []string{"id", "email", "blocked"}
+)
+
+func syncTestCustomer(client *Client, mapper *CustomerMapper, dryRun bool, row ...string) *models.CustomerSyncResult {
+	syncReq := &CustomerSyncRequest{ProfileID: "p1", Client: client, DryRun: dryRun, Logger: nopLogger{}}
+	return syncCustomer(client, syncReq, mapper, 2, row)
+}
+
+func TestSyncCustomerUpsert(t *testing.T) {
+	SetStore(NewMemoryStore())
+	fake, client := newFakePayabbhi(t)
+	full := newTestCustomerMapper(t, fullCustomerColumns, fullCustomerHeader)
+	contact := newTestCustomerMapper(t, contactCustomerColumns, contactCustomerHeader)
+
+	result := syncTestCustomer(client, full, false, "C1", "Acme", "a@acme.in", "Pune", "Maharashtra", "HDFC0000001", "")
+	calls := fake.takeCalls()
+	if result.Status != CustomerSyncStatusCreated || result.CustomerID != "cust_1" {
+		t.Fatalf("first sync = %+v, want created cust_1", result)
+	}
+	if len(calls) != 1 || calls[0].Method != http.MethodPost || calls[0].Path != "/customers" {
+		t.Fatalf("first sync called %+v, want a single POST /customers", calls)
+	}
+
+	result = syncTestCustomer(client, full, false, "C1", "Acme", "a@acme.in", "Pune", "Maharashtra", "HDFC0000001", "")
+	if calls := fake.takeCalls(); result.Status != CustomerSyncStatusUnchanged || len(calls) != 0 {
+		t.Fatalf("repeated sync = %+v calling %+v, want unchanged without calls", result, calls)
+	}
+
+	// the file of another profile lacks the addresses and bank details, they are kept
+	result = syncTestCustomer(client, contact, false, "C1", "billing@acme.in", "")
+	calls = fake.takeCalls()
+	if result.Status != CustomerSyncStatusUpdated || len(result.Diff) != 1 || result.Diff[0].Field != "email" {
+		t.Fatalf("sync of a changed email = %+v, want updated with the email as only change", result)
+	}
+	if len(calls) != 1 || calls[0].Method != http.MethodPut || calls[0].Path != "/customers/cust_1" {
+		t.Fatalf("sync of a changed email called %+v, want a single PUT /customers/cust_1", calls)
+	}
+	body := calls[0].Body
+	if body["email"] != "billing@acme.in" || body["name"] != "Acme" || body["shipping_address"] == nil || body["bank_details"] == nil {
+		t.Fatalf("PUT body = %v, want the new email along with the fields last synced", body)
+	}
+	synced, err := GetStore().GetCustomer("p1", "C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored map[string]interface{}
+	if err := json.Unmarshal([]byte(synced.Payload), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if payloadJSON(stored) != payloadJSON(body) {
+		t.Fatalf("stored payload = %s, want the PUT body %s", synced.Payload, payloadJSON(body))
+	}
+
+	result = syncTestCustomer(client, contact, true, "C1", "accounts@acme.in", "")
+	if calls := fake.takeCalls(); result.Status != CustomerSyncStatusUpdated || result.Payload == nil || len(calls) != 0 {
+		t.Fatalf("dry run = %+v calling %+v, want updated with a payload without calls", result, calls)
+	}
+}
+
+func TestSyncCustomerDeactivation(t *testing.T) {
+	SetStore(NewMemoryStore())
+	fake, client := newFakePayabbhi(t)
+	contact := newTestCustomerMapper(t, contactCustomerColumns, contactCustomerHeader)
+
+	result := syncTestCustomer(client, contact, false, "C2", "b@acme.in", "X")
+	if calls := fake.takeCalls(); result.Status != CustomerSyncStatusSkipped || len(calls) != 0 {
+		t.Fatalf("sync of a blocked new customer = %+v calling %+v, want skipped without calls", result, calls)
+	}
+
+	syncTestCustomer(client, contact, false, "C1", "a@acme.in", "")
+	fake.takeCalls()
+
+	result = syncTestCustomer(client, contact, false, "C1", "a@acme.in", "X")
+	if calls := fake.takeCalls(); result.Status != CustomerSyncStatusDeactivatedLocally || len(calls) != 0 {
+		t.Fatalf("sync of a blocked customer = %+v calling %+v, want deactivated_locally without calls", result, calls)
+	}
+	if active, _ := listActiveCustomers("p1"); len(active) != 0 {
+		t.Fatalf("listActiveCustomers() = %d customers, want none", len(active))
+	}
+
+	result = syncTestCustomer(client, contact, false, "C1", "a@acme.in", "X")
+	if result.Status != CustomerSyncStatusUnchanged {
+		t.Fatalf("sync of a deactivated blocked customer = %+v, want unchanged", result)
+	}
+
+	result = syncTestCustomer(client, contact, false, "C1", "a@acme.in", "")
+	if calls := fake.takeCalls(); result.Status != CustomerSyncStatusUnchanged || len(calls) != 0 {
+		t.Fatalf("sync of an unblocked customer = %+v calling %+v, want unchanged without calls", result, calls)
+	}
+	if active, _ := listActiveCustomers("p1"); len(active) != 1 {
+		t.Fatalf("listActiveCustomers() = %d customers, want the unblocked customer", len(active))
+	}
+}
+
+func TestMergeCustomerPayload(t *testing.T) {
+	current := `{"name":"Acme","email":"a@acme.in","notes":{"region":"west"},` +
+		`"shipping_address":{"city":"Pune","state":"Maharashtra"},"bank_details":[{"ifsc":"HDFC0000001","bank_name":"HDFC"}]}`
+	mapper := newTestCustomerMapper(t, map[string]string{
+		CustomerFieldMerchantCustomerID: "id",
+		CustomerFieldEmail:              "email",
+		CustomerFieldShippingCity:       "shipping_city",
+		CustomerFieldBankIfsc:           "ifsc",
+		CustomerFieldNotes:              "notes",
+	}, []string{"id", "email", "shipping_city", "ifsc", "notes"})
+
+	merged, err := mergeCustomerPayload(current, mapper, &CreateCustomerRequest{
+		MerchantCustomerID: "C1",
+		Email:              "billing@acme.in",
+		BankDetails:        []*BankDetail{{Ifsc: "ICIC0000001"}},
+	})
+	if err != nil {
+		t.Fatalf("mergeCustomerPayload() error = %v", err)
+	}
+	want := &CreateCustomerRequest{
+		Name:               "Acme",
+		Email:              "billing@acme.in",
+		MerchantCustomerID: "C1",
+		ShippingAddress:    &Address{State: "Maharashtra"},
+		BankDetails:        []*BankDetail{{Ifsc: "ICIC0000001", BankName: "HDFC"}},
+	}
+	if payloadJSON(merged) != payloadJSON(want) {
+		t.Fatalf("mergeCustomerPayload() = %s, want %s", payloadJSON(merged), payloadJSON(want))
+	}
+}
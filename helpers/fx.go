@@ -0,0 +1,111 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/paypermint/bridge-app-svc/util"
+	"github.com/shopspring/decimal"
+)
+
+//ErrNoFXRate is returned for an amount in a currency without a rate in the FX rate table
+var ErrNoFXRate = errors.New("no FX rate for the currency")
+
+// currencyCodePattern matches an ISO 4217 currency code
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+var fxTable *FXTable
+
+//SetFXTable sets the rates amounts in foreign currencies are converted to INR with
+func SetFXTable(table *FXTable) {
+	fxTable = table
+}
+
+//FXTable holds the INR value of a unit of every foreign currency invoices and payments are synced in
+type FXTable struct {
+	// AsOf is the date the rates were taken on, informational
+	AsOf  string                     `json:"as_of,omitempty"`
+	Rates map[string]decimal.Decimal `json:"rates"`
+}
+
+//LoadFXTable reads a JSON object with the rates, such as {"as_of": "2024-04-01", "rates": {"USD": "83.25"}}
+func LoadFXTable(path string) (*FXTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	table := &FXTable{}
+	if err := json.Unmarshal(data, table); err != nil {
+		return nil, err
+	}
+	rates := map[string]decimal.Decimal{}
+	for currency, rate := range table.Rates {
+		code := strings.ToUpper(currency)
+		if !currencyCodePattern.MatchString(code) || code == util.CurrencyINR {
+			return nil, fmt.Errorf("FX rate table: invalid currency %s", currency)
+		}
+		if rate.Sign() <= 0 {
+			return nil, fmt.Errorf("FX rate table: rate of %s must be positive", currency)
+		}
+		rates[code] = rate
+	}
+	table.Rates = rates
+	return table, nil
+}
+
+//IsSupportedCurrency returns true for INR and for the currencies of the FX rate table
+func IsSupportedCurrency(currency string) bool {
+	currency = strings.ToUpper(currency)
+	if currency == util.CurrencyINR {
+		return true
+	}
+	_, ok := fxRate(currency)
+	return ok
+}
+
+func fxRate(currency string) (decimal.Decimal, bool) {
+	if fxTable == nil {
+		return decimal.Zero, false
+	}
+	rate, ok := fxTable.Rates[currency]
+	return rate, ok
+}
+
+//ToINR returns the INR equivalent of an amount along with the rate it was converted with
+func (m *Money) ToINR() (*Money, decimal.Decimal, error) {
+	if m.currency == util.CurrencyINR {
+		return m, decimal.NewFromInt(1), nil
+	}
+	rate, ok := fxRate(m.currency)
+	if !ok {
+		return nil, decimal.Zero, ErrNoFXRate
+	}
+	inr, err := NewMoney(m.amount.Mul(rate), util.CurrencyINR)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+	return inr, rate, nil
+}
+
+// setLocalAmount sets the currency of a payment confirmation and, for a foreign currency, the INR equivalent the
+// ERP posts in the local currency of the company code
+func setLocalAmount(record *SapRecord) error {
+	if record.PaymentAmount == nil {
+		return nil
+	}
+	record.Currency = record.PaymentAmount.Currency()
+	if record.Currency == util.CurrencyINR {
+		return nil
+	}
+	local, rate, err := record.PaymentAmount.ToINR()
+	if err != nil {
+		return err
+	}
+	record.LocalAmount = local
+	record.ExchangeRate = rate.String()
+	return nil
+}
@@ -0,0 +1,160 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/paypermint/bridge-app-svc/util"
+	"github.com/paypermint/bridge-app-svc/validation"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// hsnCodePattern matches a harmonised system code of 4, 6 or 8 digits
+	hsnCodePattern = regexp.MustCompile(`^([0-9]{4}|[0-9]{6}|[0-9]{8})$`)
+	// sacCodePattern matches a services accounting code, 6 digits in chapter 99
+	sacCodePattern = regexp.MustCompile(`^99[0-9]{4}$`)
+)
+
+var maxTaxRate = decimal.NewFromInt(100)
+
+//GSTBreakdown is the tax of a line item as mapped from the SAP line fields
+type GSTBreakdown struct {
+	HsnCode      string
+	SacCode      string
+	TaxRate      json.Number
+	Cess         json.Number
+	TaxInclusive bool
+}
+
+// gstBreakdownFromRecord reads the HSN or SAC code, tax rate, cess and tax inclusive flag of an open item, all of
+// them optional. The field of the returned error is the SAP field which is invalid
+func gstBreakdownFromRecord(record ConnectorRecord) (*GSTBreakdown, string, error) {
+	breakdown := &GSTBreakdown{}
+	var err error
+	if breakdown.HsnCode, err = GetStringInterfaceParam(record, util.KeyHsnCode, true); err != nil {
+		return nil, util.KeyHsnCode, err
+	}
+	if breakdown.SacCode, err = GetStringInterfaceParam(record, util.KeySacCode, true); err != nil {
+		return nil, util.KeySacCode, err
+	}
+	breakdown.HsnCode, breakdown.SacCode = strings.TrimSpace(breakdown.HsnCode), strings.TrimSpace(breakdown.SacCode)
+	// goods carry an HSN code and services a SAC code, never both
+	if breakdown.HsnCode != EmptyString && breakdown.SacCode != EmptyString {
+		return nil, util.KeyHsnCode, errors.New(util.InvalidHsnSacCodeMsg)
+	}
+	if breakdown.HsnCode != EmptyString && !hsnCodePattern.MatchString(breakdown.HsnCode) {
+		return nil, util.KeyHsnCode, errors.New(util.InvalidPostParameterMsg)
+	}
+	if breakdown.SacCode != EmptyString && !sacCodePattern.MatchString(breakdown.SacCode) {
+		return nil, util.KeySacCode, errors.New(util.InvalidPostParameterMsg)
+	}
+	if breakdown.TaxRate, err = getPercentParam(record, util.KeyTaxRate, &maxTaxRate); err != nil {
+		return nil, util.KeyTaxRate, err
+	}
+	if breakdown.Cess, err = getPercentParam(record, util.KeyCess, nil); err != nil {
+		return nil, util.KeyCess, err
+	}
+	if breakdown.TaxInclusive, err = getFlagParam(record, util.KeyTaxInclusive); err != nil {
+		return nil, util.KeyTaxInclusive, err
+	}
+	return breakdown, EmptyString, nil
+}
+
+// getPercentParam returns the optional percentage of key in record as a JSON number, at most max when max is set
+func getPercentParam(record ConnectorRecord, key string, max *decimal.Decimal) (json.Number, error) {
+	value, ok := record[key]
+	if !ok || value == nil {
+		return EmptyString, nil
+	}
+	var percent decimal.Decimal
+	switch val := value.(type) {
+	case json.Number:
+		percent, ok = parsePercent(val.String())
+	case string:
+		if strings.TrimSpace(val) == EmptyString {
+			return EmptyString, nil
+		}
+		percent, ok = parsePercent(val)
+	case int:
+		percent = decimal.NewFromInt(int64(val))
+	case int64:
+		percent = decimal.NewFromInt(val)
+	case float64:
+		// the shortest decimal representing the float, 12.5 rather than 12.4999999
+		percent = decimal.NewFromFloat(val)
+	default:
+		ok = false
+	}
+	if !ok || percent.Sign() < 0 || (max != nil && percent.GreaterThan(*max)) {
+		return EmptyString, errors.New(util.InvalidPostParameterMsg)
+	}
+	return json.Number(percent.String()), nil
+}
+
+// parsePercent parses a rate as SAP sends it, such as 18.00 or 18.00%
+func parsePercent(s string) (decimal.Decimal, bool) {
+	percent, err := decimal.NewFromString(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	return percent, err == nil
+}
+
+// getFlagParam returns the optional flag of key in record, given as a JSON boolean or as the ABAP X for true
+func getFlagParam(record ConnectorRecord, key string) (bool, error) {
+	value, ok := record[key]
+	if !ok || value == nil {
+		return false, nil
+	}
+	if flag, ok := value.(bool); ok {
+		return flag, nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return false, errors.New(util.InvalidPostParameterMsg)
+	}
+	return parseFlag(s)
+}
+
+// parseFlag parses a flag exported from SAP, the ABAP X or blank, or a boolean
+func parseFlag(s string) (bool, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "X":
+		return true, nil
+	case EmptyString:
+		return false, nil
+	}
+	flag, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return false, errors.New(util.InvalidPostParameterMsg)
+	}
+	return flag, nil
+}
+
+// placeOfSupplyFromGstin returns the state code of a GSTIN, the place of supply of an invoice to the registered
+// customer. ok is false when gstin is not a valid GSTIN
+func placeOfSupplyFromGstin(gstin string) (string, bool) {
+	code, err := validation.GSTINStateCode(strings.ToUpper(strings.TrimSpace(gstin)))
+	if err != nil {
+		return EmptyString, false
+	}
+	return code, true
+}
+
+// customerGstin returns the GSTIN of an open item, or else the GSTIN the customer was synced with
+func customerGstin(profileID, merchantCustomerID string, record ConnectorRecord) (string, error) {
+	gstin, err := GetStringInterfaceParam(record, util.KeyGstin, true)
+	if err != nil || gstin != EmptyString {
+		return gstin, err
+	}
+	synced, err := getSyncedCustomer(profileID, merchantCustomerID)
+	if err != nil || synced == nil {
+		return EmptyString, err
+	}
+	var customer CreateCustomerRequest
+	if err := json.Unmarshal([]byte(synced.Payload), &customer); err != nil {
+		return EmptyString, nil
+	}
+	return customer.Gstin, nil
+}
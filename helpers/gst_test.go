@@ -0,0 +1,150 @@
+package helpers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+func TestGSTBreakdownFromRecord(t *testing.T) {
+	tests := []struct {
+		name      string
+		record    ConnectorRecord
+		want      GSTBreakdown
+		wantField string
+	}{
+		{name: "empty", record: ConnectorRecord{}},
+		{
+			name:   "goods",
+			record: ConnectorRecord{util.KeyHsnCode: " 84713010 ", util.KeyTaxRate: "18.00", util.KeyCess: "1"},
+			want:   GSTBreakdown{HsnCode: "84713010", TaxRate: "18", Cess: "1"},
+		},
+		{
+			name:   "services",
+			record: ConnectorRecord{util.KeySacCode: "998314", util.KeyTaxRate: "18.00%", util.KeyTaxInclusive: "X"},
+			want:   GSTBreakdown{SacCode: "998314", TaxRate: "18", TaxInclusive: true},
+		},
+		{
+			name:   "numeric fractional rates",
+			record: ConnectorRecord{util.KeyTaxRate: 12.5, util.KeyCess: 0.5},
+			want:   GSTBreakdown{TaxRate: "12.5", Cess: "0.5"},
+		},
+		{
+			name:   "json number rates",
+			record: ConnectorRecord{util.KeyTaxRate: json.Number("2.50"), util.KeyCess: json.Number("0.25")},
+			want:   GSTBreakdown{TaxRate: "2.5", Cess: "0.25"},
+		},
+		{
+			name:   "integer rate",
+			record: ConnectorRecord{util.KeyTaxRate: int64(28), util.KeyTaxInclusive: true},
+			want:   GSTBreakdown{TaxRate: "28", TaxInclusive: true},
+		},
+		{name: "blank rate", record: ConnectorRecord{util.KeyTaxRate: " "}},
+		{name: "cess above 100", record: ConnectorRecord{util.KeyCess: "290"}, want: GSTBreakdown{Cess: "290"}},
+		{name: "hsn and sac", record: ConnectorRecord{util.KeyHsnCode: "8471", util.KeySacCode: "998314"}, wantField: util.KeyHsnCode},
+		{name: "hsn of 5 digits", record: ConnectorRecord{util.KeyHsnCode: "84713"}, wantField: util.KeyHsnCode},
+		{name: "sac outside chapter 99", record: ConnectorRecord{util.KeySacCode: "988314"}, wantField: util.KeySacCode},
+		{name: "rate above 100", record: ConnectorRecord{util.KeyTaxRate: 100.5}, wantField: util.KeyTaxRate},
+		{name: "negative rate", record: ConnectorRecord{util.KeyTaxRate: "-5"}, wantField: util.KeyTaxRate},
+		{name: "rate not a number", record: ConnectorRecord{util.KeyTaxRate: "GST18"}, wantField: util.KeyTaxRate},
+		{name: "rate of another type", record: ConnectorRecord{util.KeyTaxRate: true}, wantField: util.KeyTaxRate},
+		{name: "negative cess", record: ConnectorRecord{util.KeyCess: -0.5}, wantField: util.KeyCess},
+		{name: "invalid flag", record: ConnectorRecord{util.KeyTaxInclusive: "Y"}, wantField: util.KeyTaxInclusive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, field, err := gstBreakdownFromRecord(tt.record)
+			if tt.wantField != EmptyString {
+				if err == nil || field != tt.wantField {
+					t.Fatalf("gstBreakdownFromRecord() = %+v, field %q, error %v, want an error on %s", got, field, err, tt.wantField)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("gstBreakdownFromRecord() field %s error = %v", field, err)
+			}
+			if *got != tt.want {
+				t.Fatalf("gstBreakdownFromRecord() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFlag(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    bool
+		wantErr bool
+	}{
+		{in: "X", want: true},
+		{in: "x", want: true},
+		{in: "", want: false},
+		{in: " ", want: false},
+		{in: "true", want: true},
+		{in: "0", want: false},
+		{in: "Y", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseFlag(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFlag(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("parseFlag(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaceOfSupplyFromGstin(t *testing.T) {
+	tests := []struct {
+		gstin  string
+		want   string
+		wantOK bool
+	}{
+		{gstin: "27AAPFU0939F1ZV", want: "27", wantOK: true},
+		{gstin: " 27aapfu0939f1zv ", want: "27", wantOK: true},
+		{gstin: "28AAPFU0939F1ZT", want: "37", wantOK: true},
+		{gstin: "27AAPFU0939F1ZA"},
+		{gstin: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.gstin, func(t *testing.T) {
+			got, ok := placeOfSupplyFromGstin(tt.gstin)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("placeOfSupplyFromGstin(%q) = %q, %v, want %q, %v", tt.gstin, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCustomerGstin(t *testing.T) {
+	SetStore(NewMemoryStore())
+	if err := saveSyncedCustomer("p1", &CreateCustomerRequest{MerchantCustomerID: "C1", Gstin: "29AAGCB7383J1Z4"}, "cust_1", false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name               string
+		merchantCustomerID string
+		record             ConnectorRecord
+		want               string
+	}{
+		{name: "gstin of the open item", merchantCustomerID: "C1", record: ConnectorRecord{util.KeyGstin: "27AAPFU0939F1ZV"}, want: "27AAPFU0939F1ZV"},
+		{name: "gstin of the synced customer", merchantCustomerID: "C1", record: ConnectorRecord{}, want: "29AAGCB7383J1Z4"},
+		{name: "customer not synced", merchantCustomerID: "C2", record: ConnectorRecord{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := customerGstin("p1", tt.merchantCustomerID, tt.record)
+			if err != nil {
+				t.Fatalf("customerGstin() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("customerGstin() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
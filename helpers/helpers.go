@@ -1,14 +1,11 @@
 package helpers
 
 import (
-	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"os"
 	"reflect"
 	"strconv"
 	"strings"
@@ -47,15 +44,19 @@ type SapRecord struct {
 	CompanyCode    string `json:"company_code,omitempty"`
 	Description    string `json:"description,omitempty"`
 	Item           string `json:"item,omitempty"`
-	AmountDue      string `json:"amount_due,omitempty"`
-	PaymentAmount  string `json:"payment_amount,omitempty"`
+	AmountDue      *Money `json:"amount_due,omitempty"`
+	PaymentAmount  *Money `json:"payment_amount,omitempty"`
+	Currency       string `json:"currency,omitempty"`
+	// LocalAmount is the INR equivalent of a payment in a foreign currency, converted with ExchangeRate
+	LocalAmount    *Money `json:"local_amount,omitempty"`
+	ExchangeRate   string `json:"exchange_rate,omitempty"`
 	BankAccount    string `json:"bank_account,omitempty"`
 	TransactionRef string `json:"transaction_ref,omitempty"`
 	CustomerID     string `json:"Customer_ID,omitempty"`
 }
 
 func isJWTAuthenticationRequest(request *http.Request) (string, bool) {
-	authToken := request.Header.Get("Authorization")
+	authToken := request.Header.Get(util.KeyAuthorization)
 	return authToken, strings.HasPrefix(authToken, validAuthPrefix)
 }
 
@@ -67,9 +68,15 @@ func GetCredentialsFromRequestHeader(request *http.Request) (*BasicAuthCreds, *B
 	if !basicAuthOk && !authTokenOk {
 		return nil, nil, errors.New(headerValueMissing)
 	}
+	// the environment is known once the interceptor has verified the token
+	var environment string
+	if claims, ok := TokenClaimsFromContext(request.Context()); ok {
+		environment = claims.Environment
+	}
 	if !basicAuthOk {
 		return nil, &BearerAuthCreds{
-			token: authToken,
+			token:       authToken,
+			environment: environment,
 		}, nil
 	}
 	if !authTokenOk {
@@ -82,7 +89,8 @@ func GetCredentialsFromRequestHeader(request *http.Request) (*BasicAuthCreds, *B
 			accessID:  accessID,
 			secretKey: secretKey,
 		}, &BearerAuthCreds{
-			token: authToken,
+			token:       authToken,
+			environment: environment,
 		}, nil
 }
 
@@ -209,35 +217,34 @@ func ReadCSVFromURL(url string) ([][]string, error) {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-	reader := csv.NewReader(resp.Body)
-	reader.Comma = ';'
-	data, err := reader.ReadAll()
+	records, err := NewRecordIterator(resp.Body, EmptyString)
 	if err != nil {
 		return nil, err
 	}
-
-	return data, nil
+	defer records.Close()
+	return readAllRecords(records)
 }
 
 //ReadCSVFile returns data from file location
 func ReadCSVFile(filePath string) ([][]string, error) {
-	data := make([][]string, 0)
-	csvFile, err := os.Open(filePath)
+	records, err := OpenRecordFile(filePath, EmptyString)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
-	r := csv.NewReader(csvFile)
+	defer records.Close()
+	return readAllRecords(records)
+}
+
+func readAllRecords(records *RecordIterator) ([][]string, error) {
+	data := make([][]string, 0)
 	for {
-		record, err := r.Read()
+		record, _, err := records.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-
-		// fmt.Println(record)
 		data = append(data, record)
 	}
 	return data, nil
@@ -265,6 +272,31 @@ func GetOptionalStringParam(params map[string]string, key string) (string, error
 	return EmptyString, nil
 }
 
+//GetOptionalBoolParam returns the boolean value of key in params, false if it is not present
+func GetOptionalBoolParam(params map[string]string, key string) (bool, error) {
+	value, ok := params[key]
+	if !ok {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New(util.InvalidPostParameterMsg)
+	}
+	return parsed, nil
+}
+
+//GetOptionalBoolInterfaceParam returns the boolean value of key in params, false if it is not present
+func GetOptionalBoolInterfaceParam(params map[string]interface{}, key string) (bool, error) {
+	value, ok := params[key].(string)
+	if !ok {
+		if _, present := params[key]; present {
+			return false, errors.New(util.InvalidPostParameterMsg)
+		}
+		return false, nil
+	}
+	return GetOptionalBoolParam(map[string]string{key: value}, key)
+}
+
 //GetStringInterfaceParam returns the value of key in params
 func GetStringInterfaceParam(params map[string]interface{}, key string, optional bool) (string, error) {
 	if value, ok := params[key]; ok {
@@ -296,49 +328,14 @@ func GetStringInterfaceParam(params map[string]interface{}, key string, optional
 	return EmptyString, errors.New(util.MissingMandatoryField)
 }
 
-//GetAmountParamInPaisa returns the amount field's value in paisa
+//GetAmountParamInPaisa returns the amount field's value in paisa. The amount is given in rupees as a number or as a
+//string in any format ParseMoney accepts, with isPositive it must be greater than zero
 func GetAmountParamInPaisa(params map[string]interface{}, key string, optional, isPositive bool) (int64, error) {
-	if value, ok := params[key]; ok {
-		switch val := value.(type) {
-		case json.Number:
-			valJSON := val.String()
-			intValue, err := strconv.ParseInt(valJSON, 10, 64)
-			if err != nil {
-				return 0, errors.New(util.InvalidPostParameterMsg)
-			}
-			if isPositive && intValue <= 0 {
-				return 0, errors.New(util.InvalidPostParameterMsg)
-			}
-			return intValue * 100, nil
-		case string:
-			floatValue, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
-			if err != nil {
-				return 0, errors.New(util.InvalidPostParameterMsg)
-			}
-			intValue := int64(floatValue * 100)
-			if isPositive && intValue < 0 {
-				return 0, errors.New(util.InvalidPostParameterMsg)
-			}
-			return intValue, nil
-		case int64:
-			if isPositive && val <= 0 {
-				return 0, errors.New(util.InvalidPostParameterMsg)
-			}
-			return val * 100, nil
-		case float64:
-			intValue := int64(val * 100)
-			if isPositive && intValue <= 0 {
-				return 0, errors.New(util.InvalidPostParameterMsg)
-			}
-			return intValue, nil
-		default:
-			return 0, errors.New(util.InvalidPostParameterMsg)
-		}
+	money, err := GetMoneyParam(params, key, util.CurrencyINR, optional, isPositive)
+	if err != nil || money == nil {
+		return 0, err
 	}
-	if optional {
-		return 0, nil
-	}
-	return 0, errors.New(util.MissingMandatoryField)
+	return money.MinorUnits(), nil
 }
 
 //HasUnsupportedInterfaceParameters returns true if the data map contains a key not present in the list of keys
@@ -359,7 +356,10 @@ func HasUnsupportedInterfaceParameters(data map[string]interface{}, keys ...stri
 //TODO refactor
 func GetStringInterfaceParameter(params map[string]interface{}, key string) (string, error) {
 	if value, ok := params[key]; ok {
-		if value == EmptyString || (key == util.KeyCurrency && params[key] != "INR") {
+		if value == EmptyString {
+			return EmptyString, errors.New(util.InvalidPostParameterMsg)
+		}
+		if currency, _ := value.(string); key == util.KeyCurrency && !IsSupportedCurrency(currency) {
 			return EmptyString, errors.New(util.InvalidPostParameterMsg)
 		}
 		return value.(string), nil
@@ -408,6 +408,9 @@ func GetRecordsParam(params map[string]interface{}, recordKey string, optional b
 					Item:           record.Item,
 					AmountDue:      record.AmountDue,
 					PaymentAmount:  record.PaymentAmount,
+					Currency:       record.Currency,
+					LocalAmount:    record.LocalAmount,
+					ExchangeRate:   record.ExchangeRate,
 					BankAccount:    record.BankAccount,
 					TransactionRef: record.TransactionRef,
 				})
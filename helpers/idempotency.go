@@ -0,0 +1,88 @@
+package helpers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//IdempotentResponse is the response recorded for an Idempotency-Key. It is saved before the request is handled
+//with only the fingerprint set, Completed is set once the response is known
+type IdempotentResponse struct {
+	Fingerprint string              `json:"fingerprint"`
+	Completed   bool                `json:"completed"`
+	StatusCode  int                 `json:"status_code,omitempty"`
+	Header      map[string][]string `json:"header,omitempty"`
+	Body        []byte              `json:"body,omitempty"`
+}
+
+//IdempotencyStore keeps the responses of requests made with an Idempotency-Key until they expire
+type IdempotencyStore interface {
+	// Reserve saves response unless the key exists, the existing response is returned then. ttl bounds the
+	// reservation, Complete sets how long the response is kept
+	Reserve(ctx context.Context, key string, response *IdempotentResponse, ttl time.Duration) (*IdempotentResponse, error)
+	// Complete replaces the reserved response of the key
+	Complete(ctx context.Context, key string, response *IdempotentResponse, ttl time.Duration) error
+	// Release removes the key so that the request can be made again
+	Release(ctx context.Context, key string) error
+}
+
+// idempotencySweepInterval is how often expired keys are removed from the MemoryIdempotencyStore
+const idempotencySweepInterval = time.Minute
+
+type memoryIdempotentResponse struct {
+	response  IdempotentResponse
+	expiresAt time.Time
+}
+
+//MemoryIdempotencyStore is an IdempotencyStore in process memory, keys are not shared between instances
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]*memoryIdempotentResponse
+	sweptAt   time.Time
+}
+
+//NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		responses: map[string]*memoryIdempotentResponse{},
+		sweptAt:   time.Now(),
+	}
+}
+
+//Reserve saves response unless the key exists, the existing response is returned then
+func (m *MemoryIdempotencyStore) Reserve(ctx context.Context, key string, response *IdempotentResponse, ttl time.Duration) (*IdempotentResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.Sub(m.sweptAt) > idempotencySweepInterval {
+		for k, entry := range m.responses {
+			if now.After(entry.expiresAt) {
+				delete(m.responses, k)
+			}
+		}
+		m.sweptAt = now
+	}
+	if entry, ok := m.responses[key]; ok && now.Before(entry.expiresAt) {
+		existing := entry.response
+		return &existing, nil
+	}
+	m.responses[key] = &memoryIdempotentResponse{response: *response, expiresAt: now.Add(ttl)}
+	return nil, nil
+}
+
+//Complete replaces the reserved response of the key
+func (m *MemoryIdempotencyStore) Complete(ctx context.Context, key string, response *IdempotentResponse, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[key] = &memoryIdempotentResponse{response: *response, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+//Release removes the key so that the request can be made again
+func (m *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.responses, key)
+	return nil
+}
@@ -0,0 +1,83 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisIdempotencyPrefix = "bridge-app-svc:idempotency:"
+)
+
+//RedisIdempotencyStore is an IdempotencyStore in Redis, keys are shared by all instances using the same Redis
+type RedisIdempotencyStore struct {
+	client *redis.Client
+}
+
+//NewRedisIdempotencyStore returns a RedisIdempotencyStore for the Redis at addr
+func NewRedisIdempotencyStore(addr, password string, db int) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{
+		client: redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: password,
+			DB:       db,
+		}),
+	}
+}
+
+//Ping checks that Redis can be reached
+func (r *RedisIdempotencyStore) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+//Reserve saves response unless the key exists, the existing response is returned then
+func (r *RedisIdempotencyStore) Reserve(ctx context.Context, key string, response *IdempotentResponse, ttl time.Duration) (*IdempotentResponse, error) {
+	value, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		reserved, err := r.client.SetNX(ctx, redisIdempotencyPrefix+key, value, ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if reserved {
+			return nil, nil
+		}
+		existing, err := r.client.Get(ctx, redisIdempotencyPrefix+key).Bytes()
+		if err == redis.Nil {
+			// the key expired or was released in between, try reserving it again
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		existingResponse := &IdempotentResponse{}
+		if err := json.Unmarshal(existing, existingResponse); err != nil {
+			return nil, err
+		}
+		return existingResponse, nil
+	}
+}
+
+//Complete replaces the reserved response of the key
+func (r *RedisIdempotencyStore) Complete(ctx context.Context, key string, response *IdempotentResponse, ttl time.Duration) error {
+	value, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, redisIdempotencyPrefix+key, value, ttl).Err()
+}
+
+//Release removes the key so that the request can be made again
+func (r *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	return r.client.Del(ctx, redisIdempotencyPrefix+key).Err()
+}
+
+//Close closes the connections to Redis
+func (r *RedisIdempotencyStore) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,177 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// idempotencyStoreCase is an IdempotencyStore under test along with a way to let time pass for its keys
+type idempotencyStoreCase struct {
+	name    string
+	store   IdempotencyStore
+	advance func(d time.Duration)
+}
+
+func idempotencyStoreCases(t *testing.T) []idempotencyStoreCase {
+	redisServer := miniredis.RunT(t)
+	redisStore := NewRedisIdempotencyStore(redisServer.Addr(), "", 0)
+	t.Cleanup(func() { redisStore.Close() })
+
+	return []idempotencyStoreCase{
+		{
+			name:    "memory",
+			store:   NewMemoryIdempotencyStore(),
+			advance: func(d time.Duration) { time.Sleep(d) },
+		},
+		{
+			name:    "redis",
+			store:   redisStore,
+			advance: redisServer.FastForward,
+		},
+	}
+}
+
+func TestIdempotencyStoreReserve(t *testing.T) {
+	for _, tc := range idempotencyStoreCases(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			existing, err := tc.store.Reserve(ctx, "reserve", &IdempotentResponse{Fingerprint: "a"}, time.Minute)
+			if err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if existing != nil {
+				t.Fatalf("Reserve() of a new key = %+v, want nil", existing)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreConflict(t *testing.T) {
+	for _, tc := range idempotencyStoreCases(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := tc.store.Reserve(ctx, "conflict", &IdempotentResponse{Fingerprint: "a"}, time.Minute); err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			existing, err := tc.store.Reserve(ctx, "conflict", &IdempotentResponse{Fingerprint: "a"}, time.Minute)
+			if err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if existing == nil || existing.Completed || existing.Fingerprint != "a" {
+				t.Fatalf("Reserve() of a key in progress = %+v, want the incomplete reservation", existing)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreDifferentBody(t *testing.T) {
+	for _, tc := range idempotencyStoreCases(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := tc.store.Reserve(ctx, "body", &IdempotentResponse{Fingerprint: "a"}, time.Minute); err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			existing, err := tc.store.Reserve(ctx, "body", &IdempotentResponse{Fingerprint: "b"}, time.Minute)
+			if err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if existing == nil || existing.Fingerprint != "a" {
+				t.Fatalf("Reserve() with another body = %+v, want the reservation of the first body", existing)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreReplay(t *testing.T) {
+	for _, tc := range idempotencyStoreCases(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := tc.store.Reserve(ctx, "replay", &IdempotentResponse{Fingerprint: "a"}, time.Minute); err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			completed := &IdempotentResponse{
+				Fingerprint: "a",
+				Completed:   true,
+				StatusCode:  201,
+				Header:      map[string][]string{"Location": {"/bridgeapp/v1/jobs/1"}},
+				Body:        []byte(`{"id":"1"}`),
+			}
+			if err := tc.store.Complete(ctx, "replay", completed, time.Hour); err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+			existing, err := tc.store.Reserve(ctx, "replay", &IdempotentResponse{Fingerprint: "a"}, time.Minute)
+			if err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if existing == nil || !existing.Completed || existing.StatusCode != 201 || string(existing.Body) != `{"id":"1"}` ||
+				existing.Header["Location"][0] != "/bridgeapp/v1/jobs/1" {
+				t.Fatalf("Reserve() of a completed key = %+v, want the completed response", existing)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreRelease(t *testing.T) {
+	for _, tc := range idempotencyStoreCases(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := tc.store.Reserve(ctx, "release", &IdempotentResponse{Fingerprint: "a"}, time.Minute); err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if err := tc.store.Release(ctx, "release"); err != nil {
+				t.Fatalf("Release() error = %v", err)
+			}
+			existing, err := tc.store.Reserve(ctx, "release", &IdempotentResponse{Fingerprint: "b"}, time.Minute)
+			if err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if existing != nil {
+				t.Fatalf("Reserve() of a released key = %+v, want nil", existing)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreLockExpires(t *testing.T) {
+	for _, tc := range idempotencyStoreCases(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := tc.store.Reserve(ctx, "lock", &IdempotentResponse{Fingerprint: "a"}, 50*time.Millisecond); err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			tc.advance(100 * time.Millisecond)
+			existing, err := tc.store.Reserve(ctx, "lock", &IdempotentResponse{Fingerprint: "a"}, 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if existing != nil {
+				t.Fatalf("Reserve() after the lock expired = %+v, want nil", existing)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreCompleteOutlivesLock(t *testing.T) {
+	for _, tc := range idempotencyStoreCases(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := tc.store.Reserve(ctx, "outlive", &IdempotentResponse{Fingerprint: "a"}, 50*time.Millisecond); err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if err := tc.store.Complete(ctx, "outlive", &IdempotentResponse{Fingerprint: "a", Completed: true, StatusCode: 200}, time.Hour); err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+			tc.advance(100 * time.Millisecond)
+			existing, err := tc.store.Reserve(ctx, "outlive", &IdempotentResponse{Fingerprint: "a"}, 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if existing == nil || !existing.Completed {
+				t.Fatalf("Reserve() after the lock ttl = %+v, want the completed response", existing)
+			}
+		})
+	}
+}
@@ -2,24 +2,19 @@ package helpers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/models"
 	"github.com/paypermint/bridge-app-svc/util"
 )
 
-//GetInvoicesFromSapRequest represents struct to get invoices from SAP system
-type GetInvoicesFromSapRequest struct {
-	Records []*SapRecord `json:"Records,omitempty"`
-}
-
-//GetInvoicesFromSapResponse represents struct of invoices received from SAP system
-type GetInvoicesFromSapResponse struct {
-	Records []*SapRecord `json:"Records,omitempty"`
-}
-
 //CreateOrUpdatePayabbhiInvoiceRequest represents struct to create or update invoice Request
 type CreateOrUpdatePayabbhiInvoiceRequest struct {
 	CustomerID             string                 `json:"customer_id,omitempty"`
@@ -42,209 +37,276 @@ type CreateOrUpdatePayabbhiInvoiceRequest struct {
 
 //LineItem represents LineItem struct
 type LineItem struct {
-	Id                    string `json:"id,omitempty"`
-	Name                  string `json:"name,omitempty"`
-	Amount                int64  `json:"amount,omitempty"`
-	Currency              string `json:"currency,omitempty"`
-	MerchantInvoiceItemId string `json:"merchant_invoice_item_id,omitempty"`
+	Id                    string      `json:"id,omitempty"`
+	Name                  string      `json:"name,omitempty"`
+	Amount                int64       `json:"amount,omitempty"`
+	Currency              string      `json:"currency,omitempty"`
+	MerchantInvoiceItemId string      `json:"merchant_invoice_item_id,omitempty"`
+	HsnCode               string      `json:"hsn_code,omitempty"`
+	SacCode               string      `json:"sac_code,omitempty"`
+	TaxRate               json.Number `json:"tax_rate,omitempty"`
+	Cess                  json.Number `json:"cess,omitempty"`
+	TaxInclusive          bool        `json:"tax_inclusive,omitempty"`
 }
 
-// GetInvoicesFromSap calls SAP api for fetching invoices
-func (c *Client) GetInvoicesFromSap(getInvoicesFromSapRequest *GetInvoicesFromSapRequest) (*SAPSuccessResponse, error) {
-	jsonValue, _ := json.Marshal(getInvoicesFromSapRequest)
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/fipaycollectionib", c.baseURL), bytes.NewBuffer(jsonValue))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	res := GetInvoicesFromSapResponse{
-		Records: []*SapRecord{},
-	}
-	var response *SAPSuccessResponse
-	if response, err = c.sendRequestToSAP(req, res); err != nil {
-		return nil, err
-	}
-
-	return response, nil
+//Invoice represents the payabbhi invoice returned by the invoice api
+type Invoice struct {
+	ID                string `json:"id"`
+	MerchantInvoiceID string `json:"merchant_invoice_id,omitempty"`
 }
 
 // CreateOrUpdatePayabbhiInvoice calls payabbhi api for creating or updating invoice
-func (c *Client) CreateOrUpdatePayabbhiInvoice(createOrUpdatePayabbhiInvoiceRequest *CreateOrUpdatePayabbhiInvoiceRequest, platform string) error {
+func (c *Client) CreateOrUpdatePayabbhiInvoice(createOrUpdatePayabbhiInvoiceRequest *CreateOrUpdatePayabbhiInvoiceRequest, platform string) (*Invoice, error) {
 	jsonValue, _ := json.Marshal(createOrUpdatePayabbhiInvoiceRequest)
 	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/invoice_ins", c.baseURL), bytes.NewBuffer(jsonValue))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Platform", platform)
-	if err := c.sendRequestToPayabbhi(req, nil); err != nil {
-		return err
+	if createOrUpdatePayabbhiInvoiceRequest.MerchantInvoiceID != EmptyString {
+		// the invoice is upserted by its merchant_invoice_id, without one every request creates an invoice
+		req = markIdempotent(req)
 	}
-
-	return nil
-}
-
-func toGetInvoicesFromSapRequest(merchantCustomerID string) *GetInvoicesFromSapRequest {
-	return &GetInvoicesFromSapRequest{
-		Records: []*SapRecord{
-			{
-				CustomerID: merchantCustomerID,
-			},
-		},
+	invoice := &Invoice{}
+	if err := c.sendRequestToPayabbhi(req, invoice); err != nil {
+		return nil, err
 	}
+
+	return invoice, nil
 }
 
-func toCreateOrUpdatePayabbhiInvoiceRequest(w http.ResponseWriter, appCtx *appkit.AppContext, params map[string]string, sapInvoiceObj map[string]interface{}) (*CreateOrUpdatePayabbhiInvoiceRequest, error) {
+func toCreateOrUpdatePayabbhiInvoiceRequest(params map[string]string, record ConnectorRecord, gstin string) (*CreateOrUpdatePayabbhiInvoiceRequest, string, error) {
 	//Mandatory
 	customerID, err := GetStringParam(params, util.KeyCustomerID)
 	if err != nil {
-		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyCustomerID)
-		return nil, err
+		return nil, util.KeyCustomerID, err
 	}
 
 	//optional
-	description, err := GetStringInterfaceParam(sapInvoiceObj, util.KeySapDescription, true)
+	description, err := GetStringInterfaceParam(record, util.KeySapDescription, true)
 	if err != nil {
-		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeySapDescription)
-		return nil, err
+		return nil, util.KeySapDescription, err
 	}
 
 	//optional
-	item, err := GetStringInterfaceParam(sapInvoiceObj, util.KeySapItem, true)
+	item, err := GetStringInterfaceParam(record, util.KeySapItem, true)
 	if err != nil {
-		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeySapItem)
-		return nil, err
+		return nil, util.KeySapItem, err
 	}
 
 	//optional
-	label, err := GetStringInterfaceParam(sapInvoiceObj, util.KeySapCompanyCode, true)
+	label, err := GetStringInterfaceParam(record, util.KeySapCompanyCode, true)
 	if err != nil {
-		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeySapCompanyCode)
-		return nil, err
+		return nil, util.KeySapCompanyCode, err
 	}
 
-	//Mandatory
-	amountDue, err := GetAmountParamInPaisa(sapInvoiceObj, util.KeySapAmountDue, false, true)
+	//optional, the currency of the SAP document
+	currency, err := GetStringInterfaceParam(record, util.KeySapCurrency, true)
+	if err != nil {
+		return nil, util.KeySapCurrency, err
+	}
+	currency = strings.ToUpper(currency)
+	if currency == EmptyString {
+		currency = util.CurrencyINR
+	}
+	if !IsSupportedCurrency(currency) {
+		return nil, util.KeySapCurrency, errors.New(util.UnsupportedCurrencyMsg)
+	}
+
+	//Mandatory, in the minor unit of the currency
+	amountDue, err := GetMoneyParam(record, util.KeySapAmountDue, currency, false, true)
 	if err != nil {
-		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeySapAmountDue)
+		return nil, util.KeySapAmountDue, err
+	}
+
+	//optional
+	gst, field, err := gstBreakdownFromRecord(record)
+	if err != nil {
+		return nil, field, err
+	}
+
+	// an invoice to a registered customer is supplied to the state of the customer's GSTIN
+	var placeOfSupply string
+	if gstin != EmptyString {
+		var ok bool
+		if placeOfSupply, ok = placeOfSupplyFromGstin(gstin); !ok {
+			return nil, util.KeyGstin, errors.New(util.InvalidPostParameterMsg)
+		}
 	}
 
 	return &CreateOrUpdatePayabbhiInvoiceRequest{
 		CustomerID:         customerID,
 		MerchantInvoiceID:  item,
 		Description:        description,
-		AmountDue:          amountDue,
+		AmountDue:          amountDue.MinorUnits(),
 		PartialPaymentMode: true,
-		Currency:           util.CurrencyINR,
+		Currency:           currency,
+		PlaceOfSupply:      placeOfSupply,
 		Label:              label,
 		LineItems: []*LineItem{
 			{
 				MerchantInvoiceItemId: item,
 				Name:                  fmt.Sprintf("%s_item", description),
-				Currency:              util.CurrencyINR,
-				Amount:                amountDue,
+				Currency:              currency,
+				Amount:                amountDue.MinorUnits(),
+				HsnCode:               gst.HsnCode,
+				SacCode:               gst.SacCode,
+				TaxRate:               gst.TaxRate,
+				Cess:                  gst.Cess,
+				TaxInclusive:          gst.TaxInclusive,
 			},
 		},
-	}, nil
+	}, EmptyString, nil
 }
 
-// SyncInvoicesWithSAP performs syncing of invoices between payabbhi & SAP system
-func SyncInvoicesWithSAP(w http.ResponseWriter, req *http.Request, appCtx *appkit.AppContext) {
-	ctxLogger := appkit.GetContextLogger(appCtx.Logger, req)
-	traceID := appkit.TraceIDFromHTTPRequest(req)
-	vClient, err := appkit.VaultConnect(appCtx, traceID)
-	if err != nil {
-		ctxLogger.Crit(err.Error())
-		util.RenderAPIErrorJSON(appCtx, w)
-		return
-	}
-
-	// sap user credentials from vault
-	userid, password, fetchErr := vClient.SAPClientCreds(GetSapUserCredsPath())
-	if fetchErr != nil {
-		ctxLogger.Crit(fetchErr.Error())
-		util.RenderAPIErrorJSON(appCtx, w)
-		return
-	}
-	fmt.Println("Calling Create SAP Client")
-	sapClient := CreateSAPClient(req.RemoteAddr, userid, password)
-	fmt.Println("SAP Client Created")
-	fmt.Println("RemoteAddr")
-	fmt.Println(req.RemoteAddr)
-	fmt.Println("baseURL")
-	fmt.Println(sapClient.baseURL)
-	fmt.Println("AccessId")
-	fmt.Println(sapClient.basicAuthCreds.accessID)
-	fmt.Println("SecretKey")
-	fmt.Println(sapClient.basicAuthCreds.secretKey)
-	fmt.Println("SAP Client Created")
-	params, _, _ := GetRequestParams(req, "PUT")
-	if field, ok := HasUnsupportedParameters(params, util.KeyMerchantCustomerID, util.KeyCustomerID); ok {
-		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, util.UnsupportedParamMsg, field)
-		return
+//InvoiceSyncRequest holds what an invoice sync needs once the originating request has completed
+type InvoiceSyncRequest struct {
+	ProfileID          string
+	SyncWith           string
+	MerchantCustomerID string
+	Params             map[string]string
+	Platform           string
+	// DryRun fetches and maps the open items without pushing invoices, the job result is the preview instead
+	DryRun           bool
+	ConnectorOptions *ConnectorOptions
+	PayabbhiClient   *Client
+	Logger           appkit.AppLogger
+}
+
+// SyncInvoicesJob returns the job syncing the open items of a customer into payabbhi invoices.
+// Items unchanged since the last sync are not pushed again
+func SyncInvoicesJob(syncReq *InvoiceSyncRequest) JobFunc {
+	return func(ctx context.Context, job *Job) (interface{}, error) {
+		opts := *syncReq.ConnectorOptions
+		opts.Context = ctx
+		connector, err := GetConnector(syncReq.SyncWith, &opts)
+		if err != nil {
+			syncReq.Logger.Crit(err.Error())
+			return nil, err
+		}
+
+		syncReq.Logger.Info("calling connector for fetching open items", "merchant_customer_id", syncReq.MerchantCustomerID)
+		openItems, err := connector.FetchOpenItems(syncReq.MerchantCustomerID)
+		if err != nil {
+			syncReq.Logger.Crit(err.Error())
+			return nil, err
+		}
+		syncReq.Logger.Info("Open items received", "count", len(openItems))
+		job.AddTotal(len(openItems))
+
+		preview := NewSyncPreview()
+		payabbhiClient := syncReq.PayabbhiClient.WithContext(ctx)
+		for _, openItem := range openItems {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			item, _ := GetStringInterfaceParam(openItem, util.KeySapItem, true)
+			previewItem, err := pushInvoiceToPayabbhi(payabbhiClient, syncReq, openItem)
+			previewItem.Key = item
+			preview.Items = append(preview.Items, previewItem)
+			if err != nil {
+				syncReq.Logger.Error(err.Error(), "item", item)
+				job.RecordFailed(item, previewItem.Field, err)
+				continue
+			}
+			job.RecordProcessed()
+		}
+
+		if syncReq.DryRun {
+			return preview, nil
+		}
+		return &SAPSuccessResponse{
+			Code: http.StatusOK,
+			Data: map[string]interface{}{
+				util.KeyRecords: openItems,
+			},
+		}, nil
 	}
+}
 
-	//Mandatory
-	merchantCustomerID, err := GetStringParam(params, util.KeyMerchantCustomerID)
+// pushInvoiceToPayabbhi upserts an open item as payabbhi invoice and returns what was done with it, the field
+// of the returned item is set when the open item is invalid. A dry run stops short of pushing the invoice
+func pushInvoiceToPayabbhi(payabbhiClient *Client, syncReq *InvoiceSyncRequest, openItem ConnectorRecord) (*models.SyncPreviewItem, error) {
+	previewItem := &models.SyncPreviewItem{Action: SyncActionFailed}
+	defer func() {
+		if !syncReq.DryRun {
+			countSynced(syncReq.SyncWith, MetricObjectInvoice, previewItem.Action, 1)
+		}
+	}()
+	gstin, err := customerGstin(syncReq.ProfileID, syncReq.MerchantCustomerID, openItem)
 	if err != nil {
-		util.RenderErrorJSON(appCtx, w, http.StatusBadRequest, err.Error(), util.KeyMerchantCustomerID)
-		return
+		previewItem.Message = err.Error()
+		return previewItem, err
 	}
-
-	getInvoicesFromSapRequest := toGetInvoicesFromSapRequest(merchantCustomerID)
-	ctxLogger.Info("calling SAP api for fetching invoices", "request", getInvoicesFromSapRequest)
-	sapResponse, err := sapClient.GetInvoicesFromSap(getInvoicesFromSapRequest)
+	createOrUpdatePayabbhiInvoiceRequest, field, err := toCreateOrUpdatePayabbhiInvoiceRequest(syncReq.Params, openItem, gstin)
+	if err != nil {
+		previewItem.Field = field
+		previewItem.Message = err.Error()
+		return previewItem, err
+	}
+	item := createOrUpdatePayabbhiInvoiceRequest.MerchantInvoiceID
+	invoiceFingerprint := fingerprint(createOrUpdatePayabbhiInvoiceRequest)
+	synced, err := getSyncedInvoice(syncReq.ProfileID, item)
 	if err != nil {
-		ctxLogger.Crit(err.Error())
-		util.RenderAPIErrorJSON(appCtx, w)
-		return
+		previewItem.Message = err.Error()
+		return previewItem, err
+	}
+	if synced != nil && synced.Fingerprint == invoiceFingerprint {
+		syncReq.Logger.Info("Invoice unchanged since last sync", "merchant_invoice_id", createOrUpdatePayabbhiInvoiceRequest.MerchantInvoiceID)
+		previewItem.Action = SyncActionUnchanged
+		return previewItem, nil
+	}
+
+	previewItem.Action = SyncActionCreate
+	if synced != nil {
+		previewItem.Action = SyncActionUpdate
+	}
+	if syncReq.DryRun {
+		previewItem.Payload = createOrUpdatePayabbhiInvoiceRequest
+		if synced != nil {
+			if previewItem.Diff, err = diffPayload(synced.Payload, createOrUpdatePayabbhiInvoiceRequest); err != nil {
+				previewItem.Message = "unable to compare with synced invoice: " + err.Error()
+			}
+		}
+		return previewItem, nil
 	}
-	ctxLogger.Info("SAP Invoice Response", "response", sapResponse)
 
-	pushInvoicesToPayabbhi(w, req, params, appCtx, sapResponse)
+	syncReq.Logger.Info("calling payabbhi CreateOrUpdateInvoice api", "request", createOrUpdatePayabbhiInvoiceRequest)
+	invoice, err := payabbhiClient.CreateOrUpdatePayabbhiInvoice(createOrUpdatePayabbhiInvoiceRequest, syncReq.Platform)
+	if err != nil {
+		previewItem.Action = SyncActionFailed
+		previewItem.Message = err.Error()
+		return previewItem, err
+	}
+	syncReq.Logger.Info("Payabbhi CreateOrUpdateInvoice completed", "merchant_invoice_id", createOrUpdatePayabbhiInvoiceRequest.MerchantInvoiceID)
 
-	util.RenderJSON(appCtx, w, http.StatusOK, sapResponse)
-	return
+	if item == EmptyString {
+		return previewItem, nil
+	}
+	if err := GetStore().SaveInvoice(&SyncedInvoice{
+		ProfileID:          syncReq.ProfileID,
+		Item:               item,
+		MerchantInvoiceID:  item,
+		InvoiceID:          invoice.ID,
+		MerchantCustomerID: syncReq.MerchantCustomerID,
+		Fingerprint:        invoiceFingerprint,
+		Payload:            payloadJSON(createOrUpdatePayabbhiInvoiceRequest),
+		SyncedAt:           time.Now(),
+	}); err != nil {
+		syncReq.Logger.Error("unable to record synced invoice", "merchant_invoice_id", item, "error_message", err.Error())
+	}
+	return previewItem, nil
 }
 
-func pushInvoicesToPayabbhi(w http.ResponseWriter, req *http.Request, params map[string]string, appCtx *appkit.AppContext, sapResponse *SAPSuccessResponse) {
-	ctxLogger := appkit.GetContextLogger(appCtx.Logger, req)
-	basicAuthCreds, bearerTokenCreds, err := GetCredentialsFromRequestHeader(req)
-	if err != nil {
-		ctxLogger.Crit(err.Error())
-		util.RenderAPIErrorJSON(appCtx, w)
-		return
-	}
-
-	sapData, ok := sapResponse.Data.(map[string]interface{})
-	if !ok {
-		ctxLogger.Crit("invalid format received,Unable to parse")
-		util.RenderAPIErrorJSON(appCtx, w)
-	}
-
-	if sapInvoicesData, present := sapData["Records"]; present {
-		if sapInvoices, ok := sapInvoicesData.([]interface{}); ok {
-			payabbhiClient := NewClient(basicAuthCreds, bearerTokenCreds, req.RemoteAddr)
-			ctxLogger.Info("dynamic host ", "message", GetDynamicHost())
-			platform := req.Header.Get("Platform")
-			for _, sapInvoice := range sapInvoices {
-				if sapInvoiceObj, ok := sapInvoice.(map[string]interface{}); ok {
-					createOrUpdatePayabbhiInvoiceRequest, err := toCreateOrUpdatePayabbhiInvoiceRequest(w, appCtx, params, sapInvoiceObj)
-					if err != nil {
-						ctxLogger.Crit(err.Error())
-						util.RenderAPIErrorJSON(appCtx, w)
-						return
-					}
-					ctxLogger.Info("calling payabbhi CreateOrUpdateInvoice api", "request", createOrUpdatePayabbhiInvoiceRequest)
-					err = payabbhiClient.CreateOrUpdatePayabbhiInvoice(createOrUpdatePayabbhiInvoiceRequest, platform)
-					if err != nil {
-						ctxLogger.Crit(err.Error())
-						util.RenderAPIErrorJSON(appCtx, w)
-						return
-					}
-					ctxLogger.Info("Payabbhi CreateOrUpdateInvoice Response", "response", sapResponse)
-				}
-			}
-		}
+// getSyncedInvoice returns the invoice recorded for an item by an earlier sync, nil if there is none
+func getSyncedInvoice(profileID, item string) (*SyncedInvoice, error) {
+	if item == EmptyString {
+		return nil, nil
+	}
+	synced, err := GetStore().GetInvoice(profileID, item)
+	if err == ErrNotFound {
+		return nil, nil
 	}
+	return synced, err
 }
@@ -0,0 +1,322 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	jobObject = "job"
+	jobPrefix = "job_"
+	// maxJobRecordErrors bounds the per-record errors kept in memory for a job
+	maxJobRecordErrors = 1000
+)
+
+//Job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+//Job types
+const (
+	JobTypeCustomerSync    = "customer_sync"
+	JobTypeInvoiceSync     = "invoice_sync"
+	JobTypeInvoiceSchedule = "invoice_schedule"
+)
+
+var (
+	//ErrJobQueueFull is returned when no more jobs can be queued
+	ErrJobQueueFull = errors.New("job queue is full")
+	//ErrJobNotFound is returned when no job exists for an id
+	ErrJobNotFound = errors.New("job not found")
+	//ErrJobFinished is returned when cancelling a job which has already finished
+	ErrJobFinished = errors.New("job has already finished")
+)
+
+//JobFunc performs the work of a job, reporting progress on the given job. The returned value is the job result
+type JobFunc func(ctx context.Context, job *Job) (interface{}, error)
+
+//Job represents a unit of sync work running in the background
+type Job struct {
+	mu          sync.RWMutex
+	id          string
+	jobType     string
+	status      string
+	total       int64
+	processed   int64
+	failed      int64
+	errors      []*models.JobRecordError
+	result      interface{}
+	err         string
+	createdAt   time.Time
+	startedAt   time.Time
+	completedAt time.Time
+	ctx         context.Context
+	cancel      context.CancelFunc
+	fn          JobFunc
+	// profileID is the profile which submitted the job, only it can see or cancel the job
+	profileID string
+}
+
+//ID returns the id of the job
+func (j *Job) ID() string {
+	return j.id
+}
+
+//AddTotal adds to the number of records the job has to process
+func (j *Job) AddTotal(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.total += int64(n)
+}
+
+//RecordProcessed marks a record as successfully processed
+func (j *Job) RecordProcessed() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.processed++
+}
+
+//RecordFailed marks a record as processed with an error
+func (j *Job) RecordFailed(record, field string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.processed++
+	j.failed++
+	if len(j.errors) < maxJobRecordErrors {
+		j.errors = append(j.errors, &models.JobRecordError{
+			Record:  record,
+			Field:   field,
+			Message: err.Error(),
+		})
+	}
+}
+
+//Status returns the current status of the job
+func (j *Job) Status() string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.status
+}
+
+//Result returns the result of a finished job
+func (j *Job) Result() interface{} {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.result
+}
+
+//ToAPIResponse returns the API representation of the job
+func (j *Job) ToAPIResponse() *models.Job {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	recordErrors := make([]*models.JobRecordError, len(j.errors))
+	copy(recordErrors, j.errors)
+	return &models.Job{
+		ID:     j.id,
+		Object: jobObject,
+		Type:   j.jobType,
+		Status: j.status,
+		Progress: models.JobProgress{
+			Total:     j.total,
+			Processed: j.processed,
+			Failed:    j.failed,
+		},
+		Errors:      recordErrors,
+		Result:      j.result,
+		Error:       j.err,
+		CreatedAt:   j.createdAt.Unix(),
+		StartedAt:   unixOrZero(j.startedAt),
+		CompletedAt: unixOrZero(j.completedAt),
+	}
+}
+
+func (j *Job) isFinished() bool {
+	return j.status == JobStatusSucceeded || j.status == JobStatusFailed || j.status == JobStatusCancelled
+}
+
+// start moves a queued job to running, returning false if it was cancelled while queued
+func (j *Job) start() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != JobStatusQueued {
+		return false
+	}
+	j.status = JobStatusRunning
+	j.startedAt = time.Now()
+	return true
+}
+
+func (j *Job) finish(result interface{}, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.result = result
+	j.completedAt = time.Now()
+	switch {
+	case j.ctx.Err() == context.Canceled:
+		j.status = JobStatusCancelled
+	case err != nil:
+		j.status = JobStatusFailed
+		j.err = err.Error()
+	default:
+		j.status = JobStatusSucceeded
+	}
+}
+
+//JobManager runs jobs on a bounded pool of workers and keeps them for status polling
+type JobManager struct {
+	logger    appkit.AppLogger
+	mu        sync.RWMutex
+	jobs      map[string]*Job
+	queue     chan *Job
+	retention time.Duration
+}
+
+//NewJobManager starts the given number of workers. Finished jobs are forgotten after retention
+func NewJobManager(logger appkit.AppLogger, workers, queueSize int, retention time.Duration) *JobManager {
+	m := &JobManager{
+		logger:    logger,
+		jobs:      map[string]*Job{},
+		queue:     make(chan *Job, queueSize),
+		retention: retention,
+	}
+	for i := 0; i < workers; i++ {
+		go m.work()
+	}
+	return m
+}
+
+//Submit queues a job of the given type for a profile, the job is traced as part of the trace of ctx but not
+//cancelled with it
+func (m *JobManager) Submit(ctx context.Context, profileID, jobType string, fn JobFunc) (*Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(detachTrace(ctx))
+	job := &Job{
+		id:        id,
+		jobType:   jobType,
+		profileID: profileID,
+		status:    JobStatusQueued,
+		errors:    []*models.JobRecordError{},
+		createdAt: time.Now(),
+		ctx:       ctx,
+		cancel:    cancel,
+		fn:        fn,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evictExpired()
+	select {
+	case m.queue <- job:
+		m.jobs[id] = job
+		return job, nil
+	default:
+		cancel()
+		return nil, ErrJobQueueFull
+	}
+}
+
+//Get returns the job with the given id submitted by a profile. The jobs of other profiles are not found
+func (m *JobManager) Get(profileID, id string) (*Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if job, ok := m.jobs[id]; ok && job.profileID == profileID {
+		return job, nil
+	}
+	return nil, ErrJobNotFound
+}
+
+//Cancel cancels a queued or running job submitted by a profile
+func (m *JobManager) Cancel(profileID, id string) (*Job, error) {
+	job, err := m.Get(profileID, id)
+	if err != nil {
+		return nil, err
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.isFinished() {
+		return nil, ErrJobFinished
+	}
+	job.cancel()
+	if job.status == JobStatusQueued {
+		job.status = JobStatusCancelled
+		job.completedAt = time.Now()
+	}
+	return job, nil
+}
+
+func (m *JobManager) work() {
+	for job := range m.queue {
+		if !job.start() {
+			continue
+		}
+		running := jobsRunning.WithLabelValues(job.jobType)
+		running.Inc()
+		result, err := m.runJob(job)
+		running.Dec()
+		job.finish(result, err)
+		job.cancel()
+	}
+}
+
+// runJob keeps a panicking job from taking its worker down
+func (m *JobManager) runJob(job *Job) (result interface{}, err error) {
+	ctx, span := Tracer().Start(job.ctx, "job "+job.jobType, trace.WithAttributes(attribute.String("bridge.job_id", job.id)))
+	defer func() {
+		EndSpan(span, 0, err)
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			stack := make([]byte, 1024*8)
+			stack = stack[:runtime.Stack(stack, false)]
+
+			m.logger.Crit("PANIC :", "job_id", job.id, "stacktrace", string(stack))
+			err = errors.New("job aborted unexpectedly")
+		}
+	}()
+	return job.fn(ctx, job)
+}
+
+// evictExpired must be called with m.mu held
+func (m *JobManager) evictExpired() {
+	for id, job := range m.jobs {
+		job.mu.RLock()
+		expired := job.isFinished() && time.Since(job.completedAt) > m.retention
+		job.mu.RUnlock()
+		if expired {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return EmptyString, err
+	}
+	return jobPrefix + hex.EncodeToString(b), nil
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,236 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksMinRefresh bounds how often a token signed with an unknown key id refetches the key set
+const jwksMinRefresh = time.Minute
+
+// maxJWKSSize bounds the key set read from a file or URL
+const maxJWKSSize = 1 << 20
+
+//Errors of bearer token verification
+var (
+	ErrTokenKeyNotFound   = errors.New("no key of the key set matches the token key id")
+	ErrTokenDomain        = errors.New("token domain is not allowed")
+	ErrTokenProfile       = errors.New("token has no profile")
+	errJWTNotConfigured   = errors.New("bearer token verification is not configured")
+	errJWKSUnsupportedKey = errors.New("unsupported key")
+)
+
+var (
+	tokenKeys     *JWKS
+	tokenAudience string
+)
+
+//SetJWTConfig sets the key set bearer tokens are verified against and the audience they must be issued for
+func SetJWTConfig(keys *JWKS, audience string) {
+	tokenKeys = keys
+	tokenAudience = audience
+}
+
+//TokenClaims are the claims of a verified bearer token
+type TokenClaims struct {
+	ProfileID   string `json:"profile_id"`
+	Environment string `json:"env"`
+	Domain      string `json:"domain"`
+	jwt.RegisteredClaims
+}
+
+//JWKS is a JSON Web Key Set read from a file or an http(s) URL, fetched again once it is older than its ttl
+type JWKS struct {
+	source     string
+	ttl        time.Duration
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// jsonWebKey is a key of a JWKS document, only RSA signing keys are used
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+//NewJWKS reads the key set at source, a file path or an http(s) URL, and keeps it for ttl
+func NewJWKS(source string, ttl time.Duration) (*JWKS, error) {
+	jwks := &JWKS{
+		source:     source,
+		ttl:        ttl,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := jwks.refresh(); err != nil {
+		return nil, err
+	}
+	return jwks, nil
+}
+
+// key returns the public key for kid. The key set is fetched again when it has expired, or when kid is unknown and
+// the keys were not fetched within jwksMinRefresh, so rotated keys are picked up without refetching on every
+// forged key id. The cached keys keep being used when a refetch fails
+func (j *JWKS) key(kid string) (*rsa.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	key, ok := j.keys[kid]
+	age := time.Since(j.fetchedAt)
+	if (ok && age < j.ttl) || (!ok && age < jwksMinRefresh) {
+		if !ok {
+			return nil, ErrTokenKeyNotFound
+		}
+		return key, nil
+	}
+	if err := j.refreshLocked(); err != nil && !ok {
+		return nil, err
+	}
+	if refreshed, found := j.keys[kid]; found {
+		return refreshed, nil
+	}
+	return nil, ErrTokenKeyNotFound
+}
+
+func (j *JWKS) refresh() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.refreshLocked()
+}
+
+func (j *JWKS) refreshLocked() error {
+	// failed fetches also count towards jwksMinRefresh so an unavailable key set is not hammered
+	j.fetchedAt = time.Now()
+	data, err := j.read()
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("decoding key set %s: %v", j.source, err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("key set %s has no %s signing keys", j.source, tokenSigningAlgo)
+	}
+	j.keys = keys
+	return nil
+}
+
+func (j *JWKS) read() ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(j.source)
+	}
+	res, err := j.httpClient.Get(j.source)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching key set %s: %s", j.source, res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, maxJWKSSize))
+}
+
+func (k jsonWebKey) publicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" || (k.Use != EmptyString && k.Use != "sig") || (k.Alg != EmptyString && k.Alg != tokenSigningAlgo) {
+		return nil, errJWKSUnsupportedKey
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errJWKSUnsupportedKey
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+//IsJWTVerificationEnabled returns true if a key set for bearer tokens has been set
+func IsJWTVerificationEnabled() bool {
+	return tokenKeys != nil
+}
+
+//BearerTokenFromRequest returns the token of a bearer Authorization header
+func BearerTokenFromRequest(request *http.Request) (string, bool) {
+	authToken, ok := isJWTAuthenticationRequest(request)
+	if !ok {
+		return EmptyString, false
+	}
+	return strings.TrimPrefix(authToken, validAuthPrefix), true
+}
+
+//VerifyBearerToken verifies the RS256 signature, expiry and audience of a token and that it was issued for the
+//skan app or the b2b portal to a profile
+func VerifyBearerToken(token string) (*TokenClaims, error) {
+	if tokenKeys == nil {
+		return nil, errJWTNotConfigured
+	}
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{tokenSigningAlgo}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if tokenAudience != EmptyString {
+		options = append(options, jwt.WithAudience(tokenAudience))
+	}
+	claims := &TokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return tokenKeys.key(kid)
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Domain != skanAppDomain && claims.Domain != b2bPortalDomain {
+		return nil, ErrTokenDomain
+	}
+	if claims.ProfileID == EmptyString {
+		return nil, ErrTokenProfile
+	}
+	return claims, nil
+}
+
+type tokenClaimsKey struct{}
+
+//WithTokenClaims returns a copy of ctx carrying the verified claims of the caller's bearer token
+func WithTokenClaims(ctx context.Context, claims *TokenClaims) context.Context {
+	return context.WithValue(ctx, tokenClaimsKey{}, claims)
+}
+
+//TokenClaimsFromContext returns the verified claims of the caller's bearer token
+func TokenClaimsFromContext(ctx context.Context) (*TokenClaims, bool) {
+	claims, ok := ctx.Value(tokenClaimsKey{}).(*TokenClaims)
+	return claims, ok
+}
@@ -0,0 +1,239 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// jwksJSON returns the key set of the public keys by key id
+func jwksJSON(t *testing.T, keys map[string]*rsa.PrivateKey) string {
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kid: kid,
+			Kty: "RSA",
+			Alg: tokenSigningAlgo,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// setTestJWKS writes the key set to a file and verifies bearer tokens against it for the test
+func setTestJWKS(t *testing.T, keys map[string]*rsa.PrivateKey, audience string) (*JWKS, string) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeTenants(t, path, jwksJSON(t, keys))
+	jwks, err := NewJWKS(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWKS() error = %v", err)
+	}
+	previousKeys, previousAudience := tokenKeys, tokenAudience
+	SetJWTConfig(jwks, audience)
+	t.Cleanup(func() { SetJWTConfig(previousKeys, previousAudience) })
+	return jwks, path
+}
+
+func testTokenClaims() *TokenClaims {
+	return &TokenClaims{
+		ProfileID: "p1",
+		Domain:    skanAppDomain,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"bridge"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, claims *TokenClaims, key interface{}) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != EmptyString {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyBearerToken(t *testing.T) {
+	key, otherKey := newTestRSAKey(t), newTestRSAKey(t)
+	setTestJWKS(t, map[string]*rsa.PrivateKey{"k1": key}, "bridge")
+
+	withClaims := func(change func(claims *TokenClaims)) *TokenClaims {
+		claims := testTokenClaims()
+		change(claims)
+		return claims
+	}
+	publicKeyBytes := key.N.Bytes()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "valid", token: signTestToken(t, jwt.SigningMethodRS256, "k1", testTokenClaims(), key)},
+		{
+			name:  "b2b portal",
+			token: signTestToken(t, jwt.SigningMethodRS256, "k1", withClaims(func(c *TokenClaims) { c.Domain = b2bPortalDomain }), key),
+		},
+		{
+			name:    "other audience",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "k1", withClaims(func(c *TokenClaims) { c.Audience = jwt.ClaimStrings{"other"} }), key),
+			wantErr: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name:    "without audience",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "k1", withClaims(func(c *TokenClaims) { c.Audience = nil }), key),
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:    "HS256 signed with the public key",
+			token:   signTestToken(t, jwt.SigningMethodHS256, "k1", testTokenClaims(), publicKeyBytes),
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "RS512",
+			token:   signTestToken(t, jwt.SigningMethodRS512, "k1", testTokenClaims(), key),
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "unsigned",
+			token:   signTestToken(t, jwt.SigningMethodNone, "k1", testTokenClaims(), jwt.UnsafeAllowNoneSignatureType),
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "other key",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "k1", testTokenClaims(), otherKey),
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "unknown key id",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "k2", testTokenClaims(), key),
+			wantErr: ErrTokenKeyNotFound,
+		},
+		{
+			name:    "expired",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "k1", withClaims(func(c *TokenClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }), key),
+			wantErr: jwt.ErrTokenExpired,
+		},
+		{
+			name:    "without expiry",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "k1", withClaims(func(c *TokenClaims) { c.ExpiresAt = nil }), key),
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:    "other domain",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "k1", withClaims(func(c *TokenClaims) { c.Domain = "admin" }), key),
+			wantErr: ErrTokenDomain,
+		},
+		{
+			name:    "without profile",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "k1", withClaims(func(c *TokenClaims) { c.ProfileID = EmptyString }), key),
+			wantErr: ErrTokenProfile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := VerifyBearerToken(tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyBearerToken() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyBearerToken() error = %v", err)
+			}
+			if claims.ProfileID != "p1" {
+				t.Fatalf("VerifyBearerToken() = %+v, want the claims of profile p1", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyBearerTokenNotConfigured(t *testing.T) {
+	previousKeys, previousAudience := tokenKeys, tokenAudience
+	SetJWTConfig(nil, EmptyString)
+	t.Cleanup(func() { SetJWTConfig(previousKeys, previousAudience) })
+
+	key := newTestRSAKey(t)
+	if _, err := VerifyBearerToken(signTestToken(t, jwt.SigningMethodRS256, "k1", testTokenClaims(), key)); err != errJWTNotConfigured {
+		t.Fatalf("VerifyBearerToken() without key set error = %v, want %v", err, errJWTNotConfigured)
+	}
+}
+
+func TestJWKSKeyRotation(t *testing.T) {
+	key, rotatedKey := newTestRSAKey(t), newTestRSAKey(t)
+	jwks, path := setTestJWKS(t, map[string]*rsa.PrivateKey{"k1": key}, "bridge")
+	writeTenants(t, path, jwksJSON(t, map[string]*rsa.PrivateKey{"k1": key, "k2": rotatedKey}))
+	token := signTestToken(t, jwt.SigningMethodRS256, "k2", testTokenClaims(), rotatedKey)
+
+	// a key set fetched within jwksMinRefresh is not fetched again for an unknown key id
+	if _, err := VerifyBearerToken(token); !errors.Is(err, ErrTokenKeyNotFound) {
+		t.Fatalf("VerifyBearerToken() of a new key id error = %v, want %v", err, ErrTokenKeyNotFound)
+	}
+
+	jwks.mu.Lock()
+	jwks.fetchedAt = time.Now().Add(-jwksMinRefresh)
+	jwks.mu.Unlock()
+	if _, err := VerifyBearerToken(token); err != nil {
+		t.Fatalf("VerifyBearerToken() of a rotated key error = %v", err)
+	}
+
+	// the cached keys are used when the key set can not be fetched
+	writeTenants(t, path, "not json")
+	jwks.mu.Lock()
+	jwks.fetchedAt = time.Now().Add(-2 * time.Hour)
+	jwks.mu.Unlock()
+	if _, err := VerifyBearerToken(token); err != nil {
+		t.Fatalf("VerifyBearerToken() with the key set unavailable error = %v, want the cached key used", err)
+	}
+}
+
+func TestNewJWKS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	for name, content := range map[string]string{
+		"not json":       "not json",
+		"no keys":        `{"keys":[]}`,
+		"only hmac keys": `{"keys":[{"kid":"k1","kty":"oct","k":"c2VjcmV0"}]}`,
+		"only RS512 keys": `{"keys":[{"kid":"k1","kty":"RSA","alg":"RS512","n":"` +
+			base64.RawURLEncoding.EncodeToString(big.NewInt(1<<62).Bytes()) + `","e":"AQAB"}]}`,
+		"encryption keys": `{"keys":[{"kid":"k1","kty":"RSA","use":"enc","n":"` +
+			base64.RawURLEncoding.EncodeToString(big.NewInt(1<<62).Bytes()) + `","e":"AQAB"}]}`,
+	} {
+		writeTenants(t, path, content)
+		if _, err := NewJWKS(path, time.Hour); err == nil {
+			t.Fatalf("NewJWKS() of a key set with %s succeeded", name)
+		}
+	}
+	if _, err := NewJWKS(filepath.Join(t.TempDir(), "missing.json"), time.Hour); err == nil || !strings.Contains(err.Error(), "missing.json") {
+		t.Fatalf("NewJWKS() of a missing file error = %v", err)
+	}
+}
@@ -0,0 +1,374 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/paypermint/bridge-app-svc/util"
+	"github.com/paypermint/bridge-app-svc/validation"
+)
+
+//DefaultMappingProfile is the name of the mapping profile used when the request names none
+const DefaultMappingProfile = "default"
+
+//CreateCustomerRequest fields a mapping profile can feed
+const (
+	CustomerFieldName                 = "name"
+	CustomerFieldEmail                = "email"
+	CustomerFieldContactNo            = "contact_no"
+	CustomerFieldGstin                = "gstin"
+	CustomerFieldNotes                = "notes"
+	CustomerFieldMerchantCustomerID   = "merchant_customer_id"
+	CustomerFieldHasPortalAccess      = "has_portal_access"
+	CustomerFieldLabel                = "label"
+	CustomerFieldEnv                  = "env"
+	CustomerFieldBillingAddressLine1  = "billing_address.address_line1"
+	CustomerFieldBillingAddressLine2  = "billing_address.address_line2"
+	CustomerFieldBillingCity          = "billing_address.city"
+	CustomerFieldBillingState         = "billing_address.state"
+	CustomerFieldBillingPin           = "billing_address.pin"
+	CustomerFieldShippingAddressLine1 = "shipping_address.address_line1"
+	CustomerFieldShippingAddressLine2 = "shipping_address.address_line2"
+	CustomerFieldShippingCity         = "shipping_address.city"
+	CustomerFieldShippingState        = "shipping_address.state"
+	CustomerFieldShippingPin          = "shipping_address.pin"
+	CustomerFieldBankName             = "bank_details.bank_name"
+	CustomerFieldBankIfsc             = "bank_details.ifsc"
+	CustomerFieldBankAccountNo        = "bank_details.account_no"
+	CustomerFieldBankAccountType      = "bank_details.account_type"
+	CustomerFieldBankBeneficiaryName  = "bank_details.beneficiary_name"
+	// CustomerFieldBlocked flags a customer blocked in the ERP, it is deactivated rather than synced
+	CustomerFieldBlocked = "blocked"
+)
+
+var customerFields = map[string]bool{
+	CustomerFieldName: true, CustomerFieldEmail: true, CustomerFieldContactNo: true, CustomerFieldGstin: true,
+	CustomerFieldNotes: true, CustomerFieldMerchantCustomerID: true, CustomerFieldHasPortalAccess: true,
+	CustomerFieldLabel: true, CustomerFieldEnv: true,
+	CustomerFieldBillingAddressLine1: true, CustomerFieldBillingAddressLine2: true, CustomerFieldBillingCity: true,
+	CustomerFieldBillingState: true, CustomerFieldBillingPin: true,
+	CustomerFieldShippingAddressLine1: true, CustomerFieldShippingAddressLine2: true, CustomerFieldShippingCity: true,
+	CustomerFieldShippingState: true, CustomerFieldShippingPin: true,
+	CustomerFieldBankName: true, CustomerFieldBankIfsc: true, CustomerFieldBankAccountNo: true,
+	CustomerFieldBankAccountType: true, CustomerFieldBankBeneficiaryName: true, CustomerFieldBlocked: true,
+}
+
+//MappingProfile says which header of a customer file feeds which CreateCustomerRequest field
+type MappingProfile struct {
+	Name string `json:"name"`
+	// Columns maps a customer field to the header of the column holding it
+	Columns map[string]string `json:"columns"`
+	// Required lists the customer fields whose column must be present in the file
+	Required []string `json:"required"`
+}
+
+var defaultMappingProfile = &MappingProfile{
+	Name: DefaultMappingProfile,
+	Columns: map[string]string{
+		CustomerFieldName:                 "name",
+		CustomerFieldEmail:                "email",
+		CustomerFieldContactNo:            "contact_no",
+		CustomerFieldBillingAddressLine1:  "billing_address_line1",
+		CustomerFieldBillingAddressLine2:  "billing_address_line2",
+		CustomerFieldBillingCity:          "billing_city",
+		CustomerFieldBillingState:         "billing_state",
+		CustomerFieldBillingPin:           "billing_pin",
+		CustomerFieldShippingAddressLine1: "shipping_address_line1",
+		CustomerFieldShippingAddressLine2: "shipping_address_line2",
+		CustomerFieldShippingCity:         "shipping_city",
+		CustomerFieldShippingState:        "shipping_state",
+		CustomerFieldShippingPin:          "shipping_pin",
+		CustomerFieldGstin:                "gstin",
+		CustomerFieldNotes:                "notes",
+		CustomerFieldMerchantCustomerID:   "merchant_customer_id",
+		CustomerFieldHasPortalAccess:      "has_portal_access",
+		CustomerFieldLabel:                "label",
+		CustomerFieldEnv:                  "env",
+		CustomerFieldBankName:             "bank_name",
+		CustomerFieldBankIfsc:             "ifsc",
+		CustomerFieldBankAccountNo:        "account_no",
+		CustomerFieldBankAccountType:      "account_type",
+		CustomerFieldBankBeneficiaryName:  "beneficiary_name",
+		CustomerFieldBlocked:              "blocked",
+	},
+	Required: []string{CustomerFieldEmail, CustomerFieldContactNo, CustomerFieldMerchantCustomerID},
+}
+
+var (
+	mappingProfilesMu sync.RWMutex
+	mappingProfiles   = map[string]*MappingProfile{DefaultMappingProfile: defaultMappingProfile}
+)
+
+// headerScanRows is the number of leading rows of a customer file searched for the header row
+const headerScanRows = 10
+
+//ErrEmptyFile is returned for a customer file without a header row
+var ErrEmptyFile = errors.New(util.EmptyFileMsg)
+
+//ErrUnknownMappingProfile is returned when no mapping profile exists for a name
+var ErrUnknownMappingProfile = errors.New("unknown mapping profile")
+
+//MissingColumnError is returned when the header of a customer file lacks a required column
+type MissingColumnError struct {
+	Column string
+	Field  string
+}
+
+func (e *MissingColumnError) Error() string {
+	return fmt.Sprintf("Required column %s is missing in the file header", e.Column)
+}
+
+//LoadMappingProfiles reads a JSON array of mapping profiles. A profile named default replaces the built-in one
+func LoadMappingProfiles(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var profiles []*MappingProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return err
+	}
+	loaded := map[string]*MappingProfile{DefaultMappingProfile: defaultMappingProfile}
+	for _, profile := range profiles {
+		if err := profile.validate(); err != nil {
+			return err
+		}
+		loaded[profile.Name] = profile
+	}
+
+	mappingProfilesMu.Lock()
+	defer mappingProfilesMu.Unlock()
+	mappingProfiles = loaded
+	return nil
+}
+
+//GetMappingProfile returns the mapping profile with the given name
+func GetMappingProfile(name string) (*MappingProfile, error) {
+	if name == EmptyString {
+		name = DefaultMappingProfile
+	}
+	mappingProfilesMu.RLock()
+	defer mappingProfilesMu.RUnlock()
+	if profile, ok := mappingProfiles[name]; ok {
+		return profile, nil
+	}
+	return nil, ErrUnknownMappingProfile
+}
+
+func (p *MappingProfile) validate() error {
+	if p.Name == EmptyString {
+		return errors.New("mapping profile without name")
+	}
+	for field := range p.Columns {
+		if !customerFields[field] {
+			return fmt.Errorf("mapping profile %s: unknown customer field %s", p.Name, field)
+		}
+	}
+	for _, field := range p.Required {
+		if _, ok := p.Columns[field]; !ok {
+			return fmt.Errorf("mapping profile %s: required field %s has no column", p.Name, field)
+		}
+	}
+	return nil
+}
+
+//CustomerMapper turns the rows of a customer file into create customer requests
+type CustomerMapper struct {
+	// index of the column of each mapped field
+	index map[string]int
+}
+
+//ReadCustomerMapper finds the header row of a customer file and resolves the columns of the profile against it.
+//Spreadsheet exports often start with title rows, the header is the first of the leading rows which has all
+//the columns of the profile. The rows before it are skipped
+func (p *MappingProfile) ReadCustomerMapper(records *RecordIterator) (*CustomerMapper, error) {
+	var firstErr error
+	for i := 0; i < headerScanRows; i++ {
+		header, _, err := records.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		mapper, err := p.NewCustomerMapper(header)
+		if err == nil {
+			return mapper, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		return nil, ErrEmptyFile
+	}
+	return nil, firstErr
+}
+
+//NewCustomerMapper resolves the columns of the profile against the header row of a customer file
+func (p *MappingProfile) NewCustomerMapper(header []string) (*CustomerMapper, error) {
+	positions := map[string]int{}
+	for i, column := range header {
+		positions[normaliseHeader(column)] = i
+	}
+
+	mapper := &CustomerMapper{index: map[string]int{}}
+	for field, column := range p.Columns {
+		if i, ok := positions[normaliseHeader(column)]; ok {
+			mapper.index[field] = i
+		}
+	}
+	for _, field := range p.Required {
+		if _, ok := mapper.index[field]; !ok {
+			return nil, &MissingColumnError{Column: p.Columns[field], Field: field}
+		}
+	}
+	return mapper, nil
+}
+
+//MerchantCustomerID returns the merchant_customer_id of a row
+func (m *CustomerMapper) MerchantCustomerID(row []string) string {
+	return m.value(row, CustomerFieldMerchantCustomerID)
+}
+
+//IsBlocked returns true if the row flags the customer as blocked in the ERP
+func (m *CustomerMapper) IsBlocked(row []string) (bool, error) {
+	return parseFlag(m.value(row, CustomerFieldBlocked))
+}
+
+//Fields returns the customer fields the profile maps to a column of the file
+func (m *CustomerMapper) Fields() []string {
+	fields := make([]string, 0, len(m.index))
+	for field := range m.index {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+//ToCreateCustomerRequest maps a data row, the returned field names the customer field with an invalid value
+func (m *CustomerMapper) ToCreateCustomerRequest(row []string) (*CreateCustomerRequest, string, error) {
+	var notesJSON map[string]interface{}
+	if notes := m.value(row, CustomerFieldNotes); notes != EmptyString {
+		if err := json.Unmarshal([]byte(notes), &notesJSON); err != nil {
+			return nil, util.KeyNotes, errors.New(util.InvalidPostParameterMsg)
+		}
+	}
+
+	hasPortalAccess := true
+	if value := m.value(row, CustomerFieldHasPortalAccess); value != EmptyString {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, util.KeyHasPortalAccess, errors.New(util.InvalidPostParameterMsg)
+		}
+		hasPortalAccess = parsed
+	}
+
+	createCustomerRequest := &CreateCustomerRequest{
+		Name:      m.value(row, CustomerFieldName),
+		Email:     m.value(row, CustomerFieldEmail),
+		ContactNo: m.value(row, CustomerFieldContactNo),
+		BillingAddress: m.address(row, CustomerFieldBillingAddressLine1, CustomerFieldBillingAddressLine2,
+			CustomerFieldBillingCity, CustomerFieldBillingState, CustomerFieldBillingPin),
+		ShippingAddress: m.address(row, CustomerFieldShippingAddressLine1, CustomerFieldShippingAddressLine2,
+			CustomerFieldShippingCity, CustomerFieldShippingState, CustomerFieldShippingPin),
+		Gstin:              m.value(row, CustomerFieldGstin),
+		Notes:              notesJSON,
+		MerchantCustomerID: m.value(row, CustomerFieldMerchantCustomerID),
+		HasPortalAccess:    hasPortalAccess,
+		Label:              m.value(row, CustomerFieldLabel),
+		Env:                m.value(row, CustomerFieldEnv),
+	}
+	bankDetail := &BankDetail{
+		BankName:        m.value(row, CustomerFieldBankName),
+		Ifsc:            m.value(row, CustomerFieldBankIfsc),
+		AccountNo:       m.value(row, CustomerFieldBankAccountNo),
+		AccountType:     m.value(row, CustomerFieldBankAccountType),
+		BeneficiaryName: m.value(row, CustomerFieldBankBeneficiaryName),
+	}
+	if *bankDetail != (BankDetail{}) {
+		createCustomerRequest.BankDetails = []*BankDetail{bankDetail}
+	}
+	if field, err := validateCustomerRequest(createCustomerRequest); err != nil {
+		return nil, field, err
+	}
+	return createCustomerRequest, EmptyString, nil
+}
+
+// validateCustomerRequest checks the GSTIN and the addresses of a customer offline, so that a row Payabbhi would
+// reject fails with the field at fault. The states of the addresses are normalised to their canonical names
+func validateCustomerRequest(customer *CreateCustomerRequest) (string, error) {
+	if field, err := validateAddress(customer.BillingAddress, util.KeyBillingAddressState, util.KeyBillingAddressPin); err != nil {
+		return field, err
+	}
+	if field, err := validateAddress(customer.ShippingAddress, util.KeyShippingAddressState, util.KeyShippingAddressPin); err != nil {
+		return field, err
+	}
+	if customer.Gstin == EmptyString {
+		return EmptyString, nil
+	}
+	customer.Gstin = strings.ToUpper(customer.Gstin)
+	if err := validation.ValidateGSTIN(customer.Gstin); err != nil {
+		return util.KeyGstin, err
+	}
+	// a registered customer is billed in the state of its GSTIN
+	if customer.BillingAddress != nil && customer.BillingAddress.State != EmptyString {
+		if err := validation.ValidateGSTINState(customer.Gstin, customer.BillingAddress.State); err != nil {
+			return util.KeyGstin, err
+		}
+	}
+	return EmptyString, nil
+}
+
+func validateAddress(address *Address, stateField, pinField string) (string, error) {
+	if address == nil {
+		return EmptyString, nil
+	}
+	if address.State != EmptyString {
+		state, err := validation.NormaliseState(address.State)
+		if err != nil {
+			return stateField, err
+		}
+		address.State = state
+	}
+	if address.Pin != EmptyString {
+		if err := validation.ValidatePIN(address.Pin, address.State); err != nil {
+			return pinField, err
+		}
+	}
+	return EmptyString, nil
+}
+
+func (m *CustomerMapper) address(row []string, line1, line2, city, state, pin string) *Address {
+	address := &Address{
+		AddressLine1: m.value(row, line1),
+		AddressLine2: m.value(row, line2),
+		City:         m.value(row, city),
+		State:        m.value(row, state),
+		Pin:          m.value(row, pin),
+	}
+	if *address == (Address{}) {
+		return nil
+	}
+	return address
+}
+
+// value returns the trimmed value of a field, empty if the field is not mapped or the row is short
+func (m *CustomerMapper) value(row []string, field string) string {
+	i, ok := m.index[field]
+	if !ok || i >= len(row) {
+		return EmptyString
+	}
+	return strings.TrimSpace(row[i])
+}
+
+func normaliseHeader(column string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+}
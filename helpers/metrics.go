@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "bridge_app"
+
+//Synced objects counted by the records synced metric
+const (
+	MetricObjectCustomer = "customer"
+	MetricObjectInvoice  = "invoice"
+	MetricObjectPayment  = "payment"
+)
+
+//Outcomes of a payment confirmation counted by the records synced metric
+const (
+	paymentOutcomePosted    = "posted"
+	paymentOutcomeDuplicate = "duplicate"
+	paymentOutcomeFailed    = "failed"
+)
+
+// customerConnector labels the records of customer files, which do not come through an ERP connector
+const customerConnector = "file"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Requests served, by route name, method and status code",
+	}, []string{"route", "method", "code"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of served requests, by route name and method",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	upstreamRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of every attempt of an outbound request, by upstream and operation",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"upstream", "operation"})
+	upstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_errors_total",
+		Help:      "Outbound request attempts which failed or were answered with an error status, by upstream and operation",
+	}, []string{"upstream", "operation"})
+	recordsSynced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "records_synced_total",
+		Help:      "Records synced, by connector, object and outcome. Dry runs are not counted",
+	}, []string{"connector", "object", "outcome"})
+	jobsRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "jobs_running",
+		Help:      "Sync jobs currently running, by job type",
+	}, []string{"type"})
+	circuitBreakerStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "circuit_breaker_state"),
+		"State of the circuit breaker of an upstream, 0 closed, 1 half open, 2 open",
+		[]string{"upstream"}, nil,
+	)
+)
+
+var circuitStateValues = map[string]float64{
+	CircuitStateClosed:   0,
+	CircuitStateHalfOpen: 1,
+	CircuitStateOpen:     2,
+}
+
+func init() {
+	prometheus.MustRegister(httpRequests, httpRequestDuration, upstreamRequestDuration, upstreamErrors,
+		recordsSynced, jobsRunning, circuitBreakerCollector{})
+}
+
+//ObserveHTTPRequest records a served request under the name of the route it matched
+func ObserveHTTPRequest(route, method string, status int, elapsed time.Duration) {
+	httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	httpRequestDuration.WithLabelValues(route, method).Observe(elapsed.Seconds())
+}
+
+// observeUpstreamRequest records an attempt of an outbound request, the operation is the last segment of the
+// request path, such as fipaycollectionib or invoice_ins
+func observeUpstreamRequest(upstream string, req *http.Request, res *http.Response, err error, elapsed time.Duration) {
+	operation := path.Base(req.URL.Path)
+	upstreamRequestDuration.WithLabelValues(upstream, operation).Observe(elapsed.Seconds())
+	if err != nil || res.StatusCode >= http.StatusBadRequest {
+		upstreamErrors.WithLabelValues(upstream, operation).Inc()
+	}
+}
+
+// observeUpstreamRejected counts a request the circuit breaker failed without calling the upstream
+func observeUpstreamRejected(upstream string, req *http.Request) {
+	upstreamErrors.WithLabelValues(upstream, path.Base(req.URL.Path)).Inc()
+}
+
+// countSynced adds n records of an object synced with the given outcome
+func countSynced(connector, object, outcome string, n int) {
+	if n > 0 {
+		recordsSynced.WithLabelValues(connector, object, outcome).Add(float64(n))
+	}
+}
+
+// circuitBreakerCollector reports the state of the circuit breakers when scraped
+type circuitBreakerCollector struct{}
+
+func (circuitBreakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- circuitBreakerStateDesc
+}
+
+func (circuitBreakerCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, breaker := range GetCircuitBreakers() {
+		state := breaker.ToAPIResponse()
+		ch <- prometheus.MustNewConstMetric(circuitBreakerStateDesc, prometheus.GaugeValue, circuitStateValues[state.State], state.Upstream)
+	}
+}
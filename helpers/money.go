@@ -0,0 +1,236 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/paypermint/bridge-app-svc/util"
+	"github.com/shopspring/decimal"
+)
+
+//Rounding modes applied when an amount has more decimals than the minor unit of its currency
+const (
+	// RoundHalfUp rounds halves away from zero, 1.005 INR is 1.01 INR
+	RoundHalfUp = "half_up"
+	// RoundHalfEven rounds halves to the even minor unit, 1.005 INR is 1.00 INR
+	RoundHalfEven = "half_even"
+	// RoundDown truncates towards zero
+	RoundDown = "down"
+	// RoundUp rounds away from zero
+	RoundUp = "up"
+	// RoundUnnecessary rejects amounts which are not a whole number of minor units
+	RoundUnnecessary = "unnecessary"
+)
+
+// defaultMinorUnitScale is the number of decimals of the minor unit of a currency not in currencyScales
+const defaultMinorUnitScale = 2
+
+// currencyScales is the number of decimals of the minor unit of the currencies whose minor unit is not the hundredth
+var currencyScales = map[string]int32{
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+}
+
+var (
+	//ErrInvalidAmount is returned for an amount which can not be parsed
+	ErrInvalidAmount = errors.New("invalid amount")
+	//ErrAmountNotRounded is returned for an amount with more decimals than its currency when rounding is unnecessary
+	ErrAmountNotRounded = errors.New("amount has more decimals than its currency")
+	//ErrCurrencyMismatch is returned when amounts of different currencies are combined
+	ErrCurrencyMismatch = errors.New("amounts are in different currencies")
+)
+
+var moneyRounding = RoundHalfUp
+
+// amountPattern matches an amount as SAP formats it, with a leading sign or a trailing minus. The integer digits are
+// plain or grouped with commas in thousands or in the Indian lakh and crore grouping
+var (
+	amountPattern     = regexp.MustCompile(`^([+-]?)([0-9,]+)(\.[0-9]+)?(-?)$`)
+	plainDigits       = regexp.MustCompile(`^[0-9]+$`)
+	thousandsGrouping = regexp.MustCompile(`^[0-9]{1,3}(,[0-9]{3})+$`)
+	indianGrouping    = regexp.MustCompile(`^[0-9]{1,2}(,[0-9]{2})*,[0-9]{3}$`)
+)
+
+//SetMoneyRounding sets how amounts with more decimals than their currency are rounded
+func SetMoneyRounding(mode string) error {
+	switch mode {
+	case RoundHalfUp, RoundHalfEven, RoundDown, RoundUp, RoundUnnecessary:
+		moneyRounding = mode
+		return nil
+	}
+	return fmt.Errorf("unknown rounding mode %s", mode)
+}
+
+//MinorUnitScale returns the number of decimals of the minor unit of currency, 2 for paisa
+func MinorUnitScale(currency string) int32 {
+	if scale, ok := currencyScales[strings.ToUpper(currency)]; ok {
+		return scale
+	}
+	return defaultMinorUnitScale
+}
+
+//Money is an exact amount in a currency, held as a whole number of minor units
+type Money struct {
+	amount   decimal.Decimal
+	currency string
+	// text is the amount as it was parsed, such as 1,234.57-, it is sent on as given unless rounding changed it
+	text string
+}
+
+//NewMoneyFromMinor returns the amount of minor units, such as paisa, in currency
+func NewMoneyFromMinor(minor int64, currency string) *Money {
+	currency = strings.ToUpper(currency)
+	return &Money{amount: decimal.New(minor, -MinorUnitScale(currency)), currency: currency}
+}
+
+//NewMoney returns amount in currency rounded to its minor unit
+func NewMoney(amount decimal.Decimal, currency string) (*Money, error) {
+	currency = strings.ToUpper(currency)
+	rounded, err := roundToScale(amount, MinorUnitScale(currency))
+	if err != nil {
+		return nil, err
+	}
+	return &Money{amount: rounded, currency: currency}, nil
+}
+
+//ParseMoney parses an amount in major units as SAP formats it, such as 1234.57, 1,234.57, 12,34,567.00 or 1234.57-
+func ParseMoney(s, currency string) (*Money, error) {
+	amount, err := parseDecimalAmount(s)
+	if err != nil {
+		return nil, err
+	}
+	money, err := NewMoney(amount, currency)
+	if err != nil {
+		return nil, err
+	}
+	if money.amount.Equal(amount) {
+		money.text = strings.TrimSpace(s)
+	}
+	return money, nil
+}
+
+//MoneyFromValue returns the amount in major units of a decoded JSON value, a json.Number, string, int64 or float64
+func MoneyFromValue(value interface{}, currency string) (*Money, error) {
+	switch val := value.(type) {
+	case json.Number:
+		return ParseMoney(val.String(), currency)
+	case string:
+		return ParseMoney(val, currency)
+	case int64:
+		return NewMoney(decimal.NewFromInt(val), currency)
+	case int:
+		return NewMoney(decimal.NewFromInt(int64(val)), currency)
+	case float64:
+		// the shortest decimal representing the float, 1234.57 rather than 1234.5699999999999
+		return NewMoney(decimal.NewFromFloat(val), currency)
+	}
+	return nil, ErrInvalidAmount
+}
+
+func parseDecimalAmount(s string) (decimal.Decimal, error) {
+	match := amountPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return decimal.Zero, ErrInvalidAmount
+	}
+	leadingSign, digits, fraction, trailingMinus := match[1], match[2], match[3], match[4]
+	if leadingSign != EmptyString && trailingMinus != EmptyString {
+		return decimal.Zero, ErrInvalidAmount
+	}
+	if !plainDigits.MatchString(digits) && !thousandsGrouping.MatchString(digits) && !indianGrouping.MatchString(digits) {
+		return decimal.Zero, ErrInvalidAmount
+	}
+	amount, err := decimal.NewFromString(strings.ReplaceAll(digits, ",", EmptyString) + fraction)
+	if err != nil {
+		return decimal.Zero, ErrInvalidAmount
+	}
+	if leadingSign == "-" || trailingMinus == "-" {
+		amount = amount.Neg()
+	}
+	return amount, nil
+}
+
+func roundToScale(amount decimal.Decimal, scale int32) (decimal.Decimal, error) {
+	switch moneyRounding {
+	case RoundHalfEven:
+		return amount.RoundBank(scale), nil
+	case RoundDown:
+		return amount.RoundDown(scale), nil
+	case RoundUp:
+		return amount.RoundUp(scale), nil
+	case RoundUnnecessary:
+		rounded := amount.Round(scale)
+		if !rounded.Equal(amount) {
+			return decimal.Zero, ErrAmountNotRounded
+		}
+		return rounded, nil
+	}
+	return amount.Round(scale), nil
+}
+
+//Currency returns the ISO 4217 code of the currency
+func (m *Money) Currency() string {
+	return m.currency
+}
+
+//Scale returns the number of decimals of the minor unit of the currency
+func (m *Money) Scale() int32 {
+	return MinorUnitScale(m.currency)
+}
+
+//MinorUnits returns the amount as a whole number of minor units, such as paisa. Amounts beyond int64 minor units
+//do not occur in invoices
+func (m *Money) MinorUnits() int64 {
+	return m.amount.Shift(m.Scale()).IntPart()
+}
+
+//Sign returns -1, 0 or 1 as the amount is negative, zero or positive
+func (m *Money) Sign() int {
+	return m.amount.Sign()
+}
+
+//Add returns the sum of two amounts of the same currency
+func (m *Money) Add(other *Money) (*Money, error) {
+	if m.currency != other.currency {
+		return nil, ErrCurrencyMismatch
+	}
+	return &Money{amount: m.amount.Add(other.amount), currency: m.currency}, nil
+}
+
+//String formats the amount in major units with the decimals of its currency
+func (m *Money) String() string {
+	return m.amount.StringFixed(m.Scale())
+}
+
+//MarshalJSON encodes the amount as a string in major units. A parsed amount is encoded as it was given, so that the
+//ERP receives the amounts of a record the way it formats them
+func (m *Money) MarshalJSON() ([]byte, error) {
+	if m.text != EmptyString {
+		return json.Marshal(m.text)
+	}
+	return json.Marshal(m.String())
+}
+
+//GetMoneyParam returns the amount of key in params in currency. With isPositive the amount must be greater than zero
+func GetMoneyParam(params map[string]interface{}, key, currency string, optional, isPositive bool) (*Money, error) {
+	value, ok := params[key]
+	if !ok {
+		if optional {
+			return nil, nil
+		}
+		return nil, errors.New(util.MissingMandatoryField)
+	}
+	money, err := MoneyFromValue(value, currency)
+	if err != nil {
+		return nil, errors.New(util.InvalidPostParameterMsg)
+	}
+	if isPositive && money.Sign() <= 0 {
+		return nil, errors.New(util.InvalidPostParameterMsg)
+	}
+	return money, nil
+}
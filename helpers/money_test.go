@@ -0,0 +1,221 @@
+package helpers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func setMoneyRounding(t *testing.T, mode string) {
+	previous := moneyRounding
+	if err := SetMoneyRounding(mode); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { moneyRounding = previous })
+}
+
+func TestParseMoneySeparators(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "1234.57", want: "1234.57"},
+		{in: "1234", want: "1234.00"},
+		{in: " 1234.5 ", want: "1234.50"},
+		{in: "1,234.57", want: "1234.57"},
+		{in: "1,234,567.00", want: "1234567.00"},
+		{in: "12,34,567.00", want: "1234567.00"},
+		{in: "1,00,00,000", want: "10000000.00"},
+		{in: "12,345", want: "12345.00"},
+		{in: "1,2345.00", wantErr: true},
+		{in: "12,34,5678", wantErr: true},
+		{in: "1,23,4567", wantErr: true},
+		{in: ",123", wantErr: true},
+		{in: "1234,", wantErr: true},
+		{in: "1.234,57", wantErr: true},
+		{in: "1 234.57", wantErr: true},
+		{in: "1234.", wantErr: true},
+		{in: ".57", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			money, err := ParseMoney(tt.in, "INR")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseMoney(%q) = %s, want an error", tt.in, money)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error = %v", tt.in, err)
+			}
+			if got := money.String(); got != tt.want {
+				t.Fatalf("ParseMoney(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoneyNegatives(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "-1234.57", want: "-1234.57"},
+		{in: "1234.57-", want: "-1234.57"},
+		{in: "1,234.57-", want: "-1234.57"},
+		{in: "+1234.57", want: "1234.57"},
+		{in: "-0.00", want: "0.00"},
+		{in: "-1234.57-", wantErr: true},
+		{in: "+1234.57-", wantErr: true},
+		{in: "--1234.57", wantErr: true},
+		{in: "1234.57--", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			money, err := ParseMoney(tt.in, "INR")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseMoney(%q) = %s, want an error", tt.in, money)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error = %v", tt.in, err)
+			}
+			if got := money.String(); got != tt.want {
+				t.Fatalf("ParseMoney(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoneyOverPrecision(t *testing.T) {
+	tests := []struct {
+		rounding string
+		in       string
+		want     string
+		wantErr  error
+	}{
+		{rounding: RoundHalfUp, in: "1.005", want: "1.01"},
+		{rounding: RoundHalfUp, in: "1.004", want: "1.00"},
+		{rounding: RoundHalfUp, in: "1.005-", want: "-1.01"},
+		{rounding: RoundHalfEven, in: "1.005", want: "1.00"},
+		{rounding: RoundHalfEven, in: "1.015", want: "1.02"},
+		{rounding: RoundDown, in: "1.009", want: "1.00"},
+		{rounding: RoundDown, in: "-1.009", want: "-1.00"},
+		{rounding: RoundUp, in: "1.001", want: "1.01"},
+		{rounding: RoundUp, in: "-1.001", want: "-1.01"},
+		{rounding: RoundUnnecessary, in: "1.10", want: "1.10"},
+		{rounding: RoundUnnecessary, in: "1.100", want: "1.10"},
+		{rounding: RoundUnnecessary, in: "1.005", wantErr: ErrAmountNotRounded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rounding+" "+tt.in, func(t *testing.T) {
+			setMoneyRounding(t, tt.rounding)
+			money, err := ParseMoney(tt.in, "INR")
+			if tt.wantErr != nil {
+				if err != tt.wantErr {
+					t.Fatalf("ParseMoney(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error = %v", tt.in, err)
+			}
+			if got := money.String(); got != tt.want {
+				t.Fatalf("ParseMoney(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoneyCurrencyExponents(t *testing.T) {
+	tests := []struct {
+		in        string
+		currency  string
+		rounding  string
+		want      string
+		wantMinor int64
+		wantScale int32
+		wantErr   bool
+	}{
+		{in: "1234.57", currency: "INR", want: "1234.57", wantMinor: 123457, wantScale: 2},
+		{in: "1234.57", currency: "usd", want: "1234.57", wantMinor: 123457, wantScale: 2},
+		{in: "1234", currency: "JPY", want: "1234", wantMinor: 1234, wantScale: 0},
+		{in: "1234.5", currency: "JPY", want: "1235", wantMinor: 1235, wantScale: 0},
+		{in: "1234.4", currency: "KRW", want: "1234", wantMinor: 1234, wantScale: 0},
+		{in: "12.345", currency: "KWD", want: "12.345", wantMinor: 12345, wantScale: 3},
+		{in: "12.3456", currency: "BHD", want: "12.346", wantMinor: 12346, wantScale: 3},
+		{in: "12.3", currency: "OMR", want: "12.300", wantMinor: 12300, wantScale: 3},
+		{in: "1234.5", currency: "JPY", rounding: RoundUnnecessary, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.currency+" "+tt.in, func(t *testing.T) {
+			if tt.rounding != EmptyString {
+				setMoneyRounding(t, tt.rounding)
+			}
+			money, err := ParseMoney(tt.in, tt.currency)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseMoney(%q, %s) = %s, want an error", tt.in, tt.currency, money)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q, %s) error = %v", tt.in, tt.currency, err)
+			}
+			if money.String() != tt.want || money.MinorUnits() != tt.wantMinor || money.Scale() != tt.wantScale {
+				t.Fatalf("ParseMoney(%q, %s) = %s, %d minor units of scale %d, want %s, %d of scale %d", tt.in, tt.currency,
+					money, money.MinorUnits(), money.Scale(), tt.want, tt.wantMinor, tt.wantScale)
+			}
+		})
+	}
+}
+
+func TestMoneyMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		money func() (*Money, error)
+		want  string
+	}{
+		{
+			name:  "parsed as given",
+			money: func() (*Money, error) { return ParseMoney("1,234.5-", "INR") },
+			want:  `"1,234.5-"`,
+		},
+		{
+			name:  "rounded",
+			money: func() (*Money, error) { return ParseMoney("1.005", "INR") },
+			want:  `"1.01"`,
+		},
+		{
+			name:  "minor units",
+			money: func() (*Money, error) { return NewMoneyFromMinor(123457, "INR"), nil },
+			want:  `"1234.57"`,
+		},
+		{
+			name:  "number",
+			money: func() (*Money, error) { return MoneyFromValue(json.Number("1234.5"), "INR") },
+			want:  `"1234.5"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			money, err := tt.money()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(money)
+			if err != nil {
+				t.Fatalf("MarshalJSON() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("MarshalJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,42 +1,228 @@
 package helpers
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/paypermint/bridge-app-svc/models"
 	"github.com/paypermint/bridge-app-svc/util"
 )
 
-//PostPaymentUpdateRequest represents struct to update payments at SAP end
-type PostPaymentUpdateRequest struct {
-	Records []*SapRecord `json:"Records,omitempty"`
-}
+//ErrPaymentPostingInProgress is returned when a payment confirmation is being posted by another request
+var ErrPaymentPostingInProgress = errors.New("payment confirmation is being posted")
+
+//PostPaymentConfirmations posts the payment confirmations of records through the connector at most once per profile,
+//transaction_ref and company code. Records posted before are left out, a submission without any record left returns
+//the result of the original posting instead of calling the ERP. Records repeated within the submission are posted
+//once and listed as duplicates in the response. force posts all records regardless
+func PostPaymentConfirmations(connector Connector, profileID string, records []*SapRecord, platform string, force bool) (*SAPSuccessResponse, error) {
+	if force {
+		response, err := connector.PostPaymentConfirmations(records, platform)
+		if err != nil {
+			countSynced(connector.Name(), MetricObjectPayment, paymentOutcomeFailed, len(records))
+			return nil, err
+		}
+		countSynced(connector.Name(), MetricObjectPayment, paymentOutcomePosted, len(records))
+		return response, savePaymentPostingsWithRetry(profileID, records, response)
+	}
 
-// PostPaymentUpdateToSAP calls SAP api for updating payments
-func (c *Client) PostPaymentUpdateToSAP(paymentUpdateRequest *PostPaymentUpdateRequest, platform string) (*SAPSuccessResponse, error) {
-	jsonValue, _ := json.Marshal(paymentUpdateRequest)
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/fipayconfirmationib", c.baseURL), bytes.NewBuffer(jsonValue))
+	claim, err := claimPaymentPostings(profileID, records)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Platform", platform)
-	res := models.PaymentUpdateResponse{
-		Records: &models.StatusRecord{},
+	countSynced(connector.Name(), MetricObjectPayment, paymentOutcomeDuplicate, len(records)-len(claim.unposted))
+	if len(claim.unposted) == 0 {
+		response, err := claim.original.Response()
+		if err != nil {
+			return nil, err
+		}
+		response.Duplicates = claim.duplicates
+		return response, nil
 	}
-	var response *SAPSuccessResponse
-	if response, err = c.sendRequestToSAP(req, res); err != nil {
+	response, err := connector.PostPaymentConfirmations(claim.unposted, platform)
+	if err != nil {
+		// the claims are released so that the records can be posted again
+		releasePaymentPostings(profileID, claim.claimed)
+		countSynced(connector.Name(), MetricObjectPayment, paymentOutcomeFailed, len(claim.unposted))
 		return nil, err
 	}
+	countSynced(connector.Name(), MetricObjectPayment, paymentOutcomePosted, len(claim.unposted))
+	err = savePaymentPostingsWithRetry(profileID, claim.unposted, response)
+	response.Duplicates = claim.duplicates
+	return response, err
+}
+
+// paymentClaim is the outcome of claiming the records of a payment submission
+type paymentClaim struct {
+	// unposted are the records to post, claimed the ones among them which are tracked
+	unposted []*SapRecord
+	claimed  []*SapRecord
+	// original is the posting of the first record posted before
+	original   *PaymentPosting
+	duplicates []*models.PaymentDuplicate
+}
+
+// claimPaymentPostings claims the records not posted before, records without transaction_ref can not be tracked
+// and are always posted. Pending postings outlasting the SAP requests of the profile are claimed again
+func claimPaymentPostings(profileID string, records []*SapRecord) (*paymentClaim, error) {
+	claim := &paymentClaim{}
+	staleBefore := time.Now().Add(-paymentClaimTimeout(profileID))
+	seen := map[[2]string]bool{}
+	for i, record := range records {
+		if record.TransactionRef == EmptyString {
+			claim.unposted = append(claim.unposted, record)
+			continue
+		}
+		key := [2]string{record.TransactionRef, record.CompanyCode}
+		if seen[key] {
+			claim.duplicates = append(claim.duplicates, &models.PaymentDuplicate{
+				Index:          i,
+				TransactionRef: record.TransactionRef,
+				CompanyCode:    record.CompanyCode,
+			})
+			continue
+		}
+		seen[key] = true
+
+		existing, err := GetStore().ClaimPaymentPosting(&PaymentPosting{
+			ProfileID:      profileID,
+			TransactionRef: record.TransactionRef,
+			CompanyCode:    record.CompanyCode,
+			Status:         PaymentPostingStatusPending,
+			PostedAt:       time.Now(),
+		}, staleBefore)
+		if err == nil && existing != nil && existing.Status == PaymentPostingStatusPending {
+			err = ErrPaymentPostingInProgress
+		}
+		if err != nil {
+			releasePaymentPostings(profileID, claim.claimed)
+			return nil, err
+		}
+		if existing == nil {
+			claim.unposted = append(claim.unposted, record)
+			claim.claimed = append(claim.claimed, record)
+			continue
+		}
+		if claim.original == nil {
+			claim.original = existing
+		}
+	}
+	return claim, nil
+}
+
+// paymentClaimTimeout returns how long a payment posting of the profile may take, every attempt of the SAP request
+// along with the backoff between them. A claim pending for longer has been left behind by a failed instance
+func paymentClaimTimeout(profileID string) time.Duration {
+	timeout := defaultSAPTimeout
+	if profile, err := GetSAPProfile(profileID); err == nil {
+		timeout = profile.timeout
+	}
+	policy := GetRetryPolicy()
+	return time.Duration(policy.MaxAttempts) * (timeout + policy.MaxDelay)
+}
+
+func releasePaymentPostings(profileID string, records []*SapRecord) {
+	for _, record := range records {
+		GetStore().DeletePaymentPosting(profileID, record.TransactionRef, record.CompanyCode)
+	}
+}
+
+// savePaymentPostingsWithRetry saves the postings of records the ERP has accepted, retrying failures as their claims
+// would otherwise stay pending until they go stale
+func savePaymentPostingsWithRetry(profileID string, records []*SapRecord, response *SAPSuccessResponse) error {
+	policy := GetRetryPolicy()
+	var err error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if err = SavePaymentPostings(profileID, records, response); err == nil {
+			return nil
+		}
+		if attempt < policy.MaxAttempts {
+			time.Sleep(policy.backoff(attempt))
+		}
+	}
+	return err
+}
+
+//SavePaymentPostings records the status and response the ERP returned for the posted payment confirmations
+func SavePaymentPostings(profileID string, records []*SapRecord, response *SAPSuccessResponse) error {
+	status := paymentStatusFromResponse(response)
+	result := payloadJSON(response)
+	postedAt := time.Now()
+	for _, record := range records {
+		if record.TransactionRef == EmptyString {
+			continue
+		}
+		if err := GetStore().SavePaymentPosting(&PaymentPosting{
+			ProfileID:      profileID,
+			TransactionRef: record.TransactionRef,
+			CompanyCode:    record.CompanyCode,
+			Status:         status,
+			Result:         result,
+			PostedAt:       postedAt,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//PreviewPaymentPostings returns what PostPaymentConfirmations would post for records, along with the earlier posting
+//of each record when there is one
+func PreviewPaymentPostings(connector Connector, profileID string, records []*SapRecord, force bool) (*models.SyncPreview, error) {
+	preview := NewSyncPreview()
+	unposted := []*SapRecord{}
+	for _, record := range records {
+		previewItem := &models.SyncPreviewItem{Key: record.TransactionRef, Action: SyncActionPost}
+		if record.TransactionRef != EmptyString {
+			posting, err := GetStore().GetPaymentPosting(profileID, record.TransactionRef, record.CompanyCode)
+			switch err {
+			case nil:
+				previewItem.Current = posting.ToAPIResponse()
+				if !force {
+					previewItem.Action = SyncActionUnchanged
+				}
+			case ErrNotFound:
+			default:
+				return nil, err
+			}
+		}
+		if previewItem.Action == SyncActionPost {
+			unposted = append(unposted, record)
+		}
+		preview.Items = append(preview.Items, previewItem)
+	}
+	if len(unposted) > 0 {
+		preview.Payload = connector.PaymentConfirmationsPayload(unposted)
+	}
+	return preview, nil
+}
 
-	return response, nil
+// paymentStatusFromResponse reads Records.Status from the decoded payment confirmation response
+func paymentStatusFromResponse(response *SAPSuccessResponse) string {
+	data, ok := response.Data.(map[string]interface{})
+	if !ok {
+		return EmptyString
+	}
+	var statusRecord interface{}
+	switch records := data[util.KeyRecords].(type) {
+	case map[string]interface{}:
+		statusRecord = records
+	case []interface{}:
+		if len(records) > 0 {
+			statusRecord = records[0]
+		}
+	}
+	if statusRecordObj, ok := statusRecord.(map[string]interface{}); ok {
+		status, _ := GetStringInterfaceParam(statusRecordObj, "Status", true)
+		return status
+	}
+	return EmptyString
 }
 
 func getRecordParamsForJSON(r *http.Request, itemKey string) (map[string]interface{}, string, error) {
@@ -102,7 +288,7 @@ func getRecordItemParamsForJSON(values []interface{}) ([]*SapRecord, string, err
 		switch vFurther := val.(type) {
 		case map[string]interface{}:
 			if field, ok := HasUnsupportedInterfaceParameters(vFurther, util.KeyCustomerNumber, util.KeyCustomerName, util.KeyCompanyCode, util.KeyItem, util.KeyAmountDue,
-				util.KeyDescription, util.KeyPaymentAmount, util.KeyBankAccount, util.KeyTransactionRef); ok {
+				util.KeyDescription, util.KeyPaymentAmount, util.KeyCurrency, util.KeyBankAccount, util.KeyTransactionRef); ok {
 				return nil, field, errors.New(util.UnsupportedParamMsg)
 			}
 			record := &SapRecord{}
@@ -131,12 +317,21 @@ func getRecordItemParamsForJSON(values []interface{}) ([]*SapRecord, string, err
 				return nil, util.KeyItem, err
 			}
 			delete(vFurther, util.KeyItem)
-			amountDue, err := GetStringInterfaceParameter(vFurther, util.KeyAmountDue)
+			// the amounts are in the currency of the SAP document, INR unless given
+			currency := util.CurrencyINR
+			if _, ok := vFurther[util.KeyCurrency]; ok {
+				if currency, err = GetStringInterfaceParameter(vFurther, util.KeyCurrency); err != nil {
+					return nil, util.KeyCurrency, err
+				}
+				currency = strings.ToUpper(currency)
+				delete(vFurther, util.KeyCurrency)
+			}
+			amountDue, err := GetMoneyParam(vFurther, util.KeyAmountDue, currency, false, false)
 			if err != nil {
 				return nil, util.KeyAmountDue, err
 			}
 			delete(vFurther, util.KeyAmountDue)
-			paymentAmount, err := GetStringInterfaceParameter(vFurther, util.KeyPaymentAmount)
+			paymentAmount, err := GetMoneyParam(vFurther, util.KeyPaymentAmount, currency, false, true)
 			if err != nil {
 				return nil, util.KeyPaymentAmount, err
 			}
@@ -160,6 +355,9 @@ func getRecordItemParamsForJSON(values []interface{}) ([]*SapRecord, string, err
 			record.PaymentAmount = paymentAmount
 			record.BankAccount = bankAccount
 			record.TransactionRef = transActionRef
+			if err := setLocalAmount(record); err != nil {
+				return nil, util.KeyPaymentAmount, errors.New(util.InvalidPostParameterMsg)
+			}
 
 			jsonString, err := json.Marshal(vFurther)
 			if err != nil {
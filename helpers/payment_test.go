@@ -0,0 +1,168 @@
+package helpers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+// fakePaymentConnector accepts the payment confirmations it is given, or fails with err, and records every call
+type fakePaymentConnector struct {
+	posted [][]*SapRecord
+	err    error
+}
+
+func (c *fakePaymentConnector) Name() string { return "fake" }
+
+func (c *fakePaymentConnector) FetchOpenItems(merchantCustomerID string) ([]ConnectorRecord, error) {
+	return nil, ErrOperationNotSupported
+}
+
+func (c *fakePaymentConnector) PostPaymentConfirmations(records []*SapRecord, platform string) (*SAPSuccessResponse, error) {
+	c.posted = append(c.posted, records)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &SAPSuccessResponse{
+		Code: http.StatusOK,
+		Data: map[string]interface{}{util.KeyRecords: map[string]interface{}{"Status": "S"}},
+	}, nil
+}
+
+func (c *fakePaymentConnector) PaymentConfirmationsPayload(records []*SapRecord) interface{} {
+	return records
+}
+
+func paymentRecord(transactionRef string) *SapRecord {
+	return &SapRecord{TransactionRef: transactionRef, CompanyCode: "1000"}
+}
+
+func TestPostPaymentConfirmationsOnce(t *testing.T) {
+	SetStore(NewMemoryStore())
+	connector := &fakePaymentConnector{}
+
+	if _, err := PostPaymentConfirmations(connector, "p1", []*SapRecord{paymentRecord("pay_1")}, EmptyString, false); err != nil {
+		t.Fatalf("PostPaymentConfirmations() error = %v", err)
+	}
+	response, err := PostPaymentConfirmations(connector, "p1", []*SapRecord{paymentRecord("pay_1")}, EmptyString, false)
+	if err != nil {
+		t.Fatalf("PostPaymentConfirmations() of a posted record error = %v", err)
+	}
+	if len(connector.posted) != 1 {
+		t.Fatalf("SAP was called %d times, want once", len(connector.posted))
+	}
+	if status := paymentStatusFromResponse(response); status != "S" {
+		t.Fatalf("PostPaymentConfirmations() of a posted record = %+v, want the stored response with status S", response)
+	}
+
+	// the same record of another profile is another payment
+	if _, err := PostPaymentConfirmations(connector, "p2", []*SapRecord{paymentRecord("pay_1")}, EmptyString, false); err != nil {
+		t.Fatalf("PostPaymentConfirmations() of another profile error = %v", err)
+	}
+	if len(connector.posted) != 2 {
+		t.Fatalf("SAP was called %d times, want the record of another profile posted", len(connector.posted))
+	}
+}
+
+func TestPostPaymentConfirmationsDuplicates(t *testing.T) {
+	SetStore(NewMemoryStore())
+	connector := &fakePaymentConnector{}
+
+	records := []*SapRecord{paymentRecord("pay_1"), paymentRecord("pay_2"), paymentRecord("pay_1"), {CompanyCode: "1000"}}
+	response, err := PostPaymentConfirmations(connector, "p1", records, EmptyString, false)
+	if err != nil {
+		t.Fatalf("PostPaymentConfirmations() error = %v", err)
+	}
+	if len(connector.posted) != 1 || len(connector.posted[0]) != 3 {
+		t.Fatalf("SAP was sent %v, want pay_1, pay_2 and the record without transaction_ref", connector.posted)
+	}
+	if len(response.Duplicates) != 1 || response.Duplicates[0].Index != 2 || response.Duplicates[0].TransactionRef != "pay_1" {
+		t.Fatalf("PostPaymentConfirmations() duplicates = %+v, want record 2 repeating pay_1", response.Duplicates)
+	}
+
+	// records without transaction_ref can not be tracked, they are posted every time
+	if _, err := PostPaymentConfirmations(connector, "p1", records, EmptyString, false); err != nil {
+		t.Fatalf("PostPaymentConfirmations() error = %v", err)
+	}
+	if len(connector.posted) != 2 || len(connector.posted[1]) != 1 || connector.posted[1][0].TransactionRef != EmptyString {
+		t.Fatalf("SAP was sent %v on the second submission, want only the record without transaction_ref", connector.posted)
+	}
+}
+
+func TestPostPaymentConfirmationsReleasesFailedClaims(t *testing.T) {
+	SetStore(NewMemoryStore())
+	connector := &fakePaymentConnector{err: errors.New("SAP unavailable")}
+
+	if _, err := PostPaymentConfirmations(connector, "p1", []*SapRecord{paymentRecord("pay_1")}, EmptyString, false); err == nil {
+		t.Fatal("PostPaymentConfirmations() with SAP failing succeeded")
+	}
+	if _, err := GetStore().GetPaymentPosting("p1", "pay_1", "1000"); err != ErrNotFound {
+		t.Fatalf("GetPaymentPosting() after a failed post error = %v, want %v", err, ErrNotFound)
+	}
+
+	connector.err = nil
+	if _, err := PostPaymentConfirmations(connector, "p1", []*SapRecord{paymentRecord("pay_1")}, EmptyString, false); err != nil {
+		t.Fatalf("PostPaymentConfirmations() after SAP recovered error = %v", err)
+	}
+	if len(connector.posted) != 2 {
+		t.Fatalf("SAP was called %d times, want the released record posted again", len(connector.posted))
+	}
+}
+
+func TestPostPaymentConfirmationsPendingClaims(t *testing.T) {
+	SetStore(NewMemoryStore())
+	connector := &fakePaymentConnector{}
+
+	claim := func(transactionRef string, claimedAt time.Time) {
+		if _, err := GetStore().ClaimPaymentPosting(&PaymentPosting{
+			ProfileID:      "p1",
+			TransactionRef: transactionRef,
+			CompanyCode:    "1000",
+			Status:         PaymentPostingStatusPending,
+			PostedAt:       claimedAt,
+		}, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claim("pay_1", time.Now())
+	if _, err := PostPaymentConfirmations(connector, "p1", []*SapRecord{paymentRecord("pay_2"), paymentRecord("pay_1")}, EmptyString, false); err != ErrPaymentPostingInProgress {
+		t.Fatalf("PostPaymentConfirmations() of a record being posted error = %v, want %v", err, ErrPaymentPostingInProgress)
+	}
+	if len(connector.posted) != 0 {
+		t.Fatalf("SAP was called %d times, want no call while a record is being posted", len(connector.posted))
+	}
+	if _, err := GetStore().GetPaymentPosting("p1", "pay_2", "1000"); err != ErrNotFound {
+		t.Fatalf("GetPaymentPosting() of the other record error = %v, want its claim released", err)
+	}
+
+	// a claim left behind by a failed instance is taken over
+	claim("pay_3", time.Now().Add(-24*time.Hour))
+	if _, err := PostPaymentConfirmations(connector, "p1", []*SapRecord{paymentRecord("pay_3")}, EmptyString, false); err != nil {
+		t.Fatalf("PostPaymentConfirmations() of a stale claim error = %v", err)
+	}
+	posting, err := GetStore().GetPaymentPosting("p1", "pay_3", "1000")
+	if err != nil || posting.Status != "S" {
+		t.Fatalf("GetPaymentPosting() of a stale claim = %+v, %v, want the posting with status S", posting, err)
+	}
+}
+
+func TestPostPaymentConfirmationsForce(t *testing.T) {
+	SetStore(NewMemoryStore())
+	connector := &fakePaymentConnector{}
+
+	for i := 0; i < 2; i++ {
+		if _, err := PostPaymentConfirmations(connector, "p1", []*SapRecord{paymentRecord("pay_1")}, EmptyString, true); err != nil {
+			t.Fatalf("PostPaymentConfirmations() with force error = %v", err)
+		}
+	}
+	if len(connector.posted) != 2 {
+		t.Fatalf("SAP was called %d times, want every forced post sent", len(connector.posted))
+	}
+	if posting, err := GetStore().GetPaymentPosting("p1", "pay_1", "1000"); err != nil || posting.Status != "S" {
+		t.Fatalf("GetPaymentPosting() after a forced post = %+v, %v, want the posting with status S", posting, err)
+	}
+}
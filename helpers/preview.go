@@ -0,0 +1,99 @@
+package helpers
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/paypermint/bridge-app-svc/models"
+)
+
+const (
+	syncPreviewObject = "sync_preview"
+)
+
+//Actions a dry run reports for a record
+const (
+	SyncActionCreate    = "create"
+	SyncActionUpdate    = "update"
+	SyncActionUnchanged = "unchanged"
+	SyncActionPost      = "post"
+	SyncActionFailed    = "failed"
+)
+
+//NewSyncPreview returns an empty dry run outcome
+func NewSyncPreview() *models.SyncPreview {
+	return &models.SyncPreview{
+		Object: syncPreviewObject,
+		DryRun: true,
+		Items:  []*models.SyncPreviewItem{},
+	}
+}
+
+// payloadJSON returns the JSON of a request as recorded in the store
+func payloadJSON(payload interface{}) string {
+	jsonValue, _ := json.Marshal(payload)
+	return string(jsonValue)
+}
+
+// diffPayload compares the JSON of the payload last synced with the payload a sync would send. Nested objects
+// and arrays are compared field by field, named by their dotted path such as billing_address.city
+func diffPayload(current string, proposed interface{}) ([]*models.FieldChange, error) {
+	var currentValue, proposedValue interface{}
+	if err := json.Unmarshal([]byte(current), &currentValue); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(payloadJSON(proposed)), &proposedValue); err != nil {
+		return nil, err
+	}
+
+	currentFields, proposedFields := map[string]interface{}{}, map[string]interface{}{}
+	flattenJSON(EmptyString, currentValue, currentFields)
+	flattenJSON(EmptyString, proposedValue, proposedFields)
+
+	names := []string{}
+	for name := range currentFields {
+		names = append(names, name)
+	}
+	for name := range proposedFields {
+		if _, ok := currentFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []*models.FieldChange{}
+	for _, name := range names {
+		if !reflect.DeepEqual(currentFields[name], proposedFields[name]) {
+			changes = append(changes, &models.FieldChange{
+				Field:    name,
+				Current:  currentFields[name],
+				Proposed: proposedFields[name],
+			})
+		}
+	}
+	return changes, nil
+}
+
+func flattenJSON(prefix string, value interface{}, fields map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenJSON(joinFieldName(prefix, key), child, fields)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenJSON(joinFieldName(prefix, strconv.Itoa(i)), child, fields)
+		}
+	default:
+		fields[prefix] = v
+	}
+}
+
+func joinFieldName(prefix, name string) string {
+	if prefix == EmptyString {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,281 @@
+package helpers
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// delimiterSniffLen is the number of bytes looked at to detect the delimiter
+	delimiterSniffLen = 64 << 10
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+	utf8BOM   = []byte("\xef\xbb\xbf")
+	// dates of XLSX cells using the default short date format are read as ISO dates
+	xlsxOptions = excelize.Options{ShortDatePattern: "yyyy-mm-dd"}
+	// delimiters detected in a file, in order of preference on a tie
+	sniffedDelimiters = []rune{',', ';', '\t'}
+)
+
+//ErrNoRecordFile is returned for a zip archive without a file to read records from
+var ErrNoRecordFile = errors.New("archive does not contain a file")
+
+//ErrUnknownSheet is returned when the sheet asked for is not part of the workbook
+var ErrUnknownSheet = errors.New("workbook does not contain the sheet")
+
+//RowError is returned by RecordIterator.Next for a row which could not be parsed. Iteration can continue past it
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Err.Error())
+}
+
+//RecordIterator streams the records of a delimited file which may be gzip or zip compressed, or of a sheet of an
+//XLSX workbook
+type RecordIterator struct {
+	read    func() ([]string, error)
+	row     int
+	closers []func() error
+}
+
+//OpenRecordFile opens a file for record iteration, sheet selects the sheet of a workbook
+func OpenRecordFile(path, sheet string) (*RecordIterator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecordIterator(file, sheet)
+}
+
+//NewRecordIterator detects the format, compression, byte order mark and delimiter of r. The records of a workbook
+//are read from sheet, or from the active sheet when it is empty. Closing the iterator closes r if it is an io.Closer,
+//as does a failure to create the iterator
+func NewRecordIterator(r io.Reader, sheet string) (*RecordIterator, error) {
+	it := &RecordIterator{}
+	if closer, ok := r.(io.Closer); ok {
+		it.closers = append(it.closers, closer.Close)
+	}
+
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(zipMagic))
+	if err != nil && err != io.EOF {
+		it.Close()
+		return nil, err
+	}
+	var content io.Reader = buffered
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		it.closers = append(it.closers, gzipReader.Close)
+		content = gzipReader
+	case bytes.HasPrefix(magic, zipMagic):
+		entry, err := it.openArchive(r, buffered, sheet)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		if entry == nil {
+			// the archive is a workbook, its rows are read by it.read
+			return it, nil
+		}
+		content = entry
+	}
+
+	buffered = bufio.NewReaderSize(content, delimiterSniffLen)
+	if bom, _ := buffered.Peek(len(utf8BOM)); bytes.Equal(bom, utf8BOM) {
+		buffered.Discard(len(utf8BOM))
+	}
+	head, err := buffered.Peek(delimiterSniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		it.Close()
+		return nil, err
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.Comma = sniffDelimiter(head)
+	// rows shorter or longer than the header are handled by the mapping, not rejected by the reader
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = false
+	it.read = reader.Read
+	return it, nil
+}
+
+//AfterClose registers a function run when the iterator is closed
+func (it *RecordIterator) AfterClose(fn func() error) {
+	it.closers = append(it.closers, fn)
+}
+
+//Next returns the next record with its 1 based row number. A row which can not be parsed is
+//returned as *RowError, io.EOF is returned once all records have been read
+func (it *RecordIterator) Next() ([]string, int, error) {
+	record, err := it.read()
+	if err == io.EOF {
+		return nil, it.row, io.EOF
+	}
+	it.row++
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); ok {
+			return nil, it.row, &RowError{Row: it.row, Err: err}
+		}
+		return nil, it.row, err
+	}
+	return record, it.row, nil
+}
+
+//Close releases the underlying reader, the closers run in reverse order of registration
+func (it *RecordIterator) Close() error {
+	var firstErr error
+	for i := len(it.closers) - 1; i >= 0; i-- {
+		if err := it.closers[i](); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	it.closers = nil
+	return firstErr
+}
+
+// openArchive opens a zip archive, which is either an XLSX workbook or holds a delimited file. For a workbook
+// it.read is set to read the rows of the sheet and no reader is returned, otherwise the first file of the archive
+// is returned. Archives need random access, a reader which is not a file is spooled to a temporary file first
+func (it *RecordIterator) openArchive(r io.Reader, buffered io.Reader, sheet string) (io.Reader, error) {
+	file, ok := r.(*os.File)
+	if !ok {
+		spool, err := os.CreateTemp(stagingDir, "zip_")
+		if err != nil {
+			return nil, err
+		}
+		it.closers = append(it.closers, func() error { return os.Remove(spool.Name()) }, spool.Close)
+		if _, err := io.Copy(spool, buffered); err != nil {
+			return nil, err
+		}
+		file = spool
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	if isWorkbook(archive) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return nil, it.openSheet(file, sheet)
+	}
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || strings.HasPrefix(entry.Name, "__MACOSX/") {
+			continue
+		}
+		entryReader, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		it.closers = append(it.closers, entryReader.Close)
+		return entryReader, nil
+	}
+	return nil, ErrNoRecordFile
+}
+
+// openSheet reads the rows of a sheet of the workbook in r. Cells are read as displayed, so numbers such as
+// PIN codes keep their digits instead of turning into floats and dates follow their cell format
+func (it *RecordIterator) openSheet(r io.Reader, sheet string) error {
+	workbook, err := excelize.OpenReader(r, xlsxOptions)
+	if err != nil {
+		return err
+	}
+	it.closers = append(it.closers, workbook.Close)
+
+	if sheet == EmptyString {
+		sheet = workbook.GetSheetName(workbook.GetActiveSheetIndex())
+	} else if index, err := workbook.GetSheetIndex(sheet); err != nil || index < 0 {
+		return ErrUnknownSheet
+	}
+	rows, err := workbook.Rows(sheet)
+	if err != nil {
+		return err
+	}
+	it.closers = append(it.closers, rows.Close)
+
+	// blank rows are skipped, as the CSV reader does for blank lines
+	it.read = func() ([]string, error) {
+		for rows.Next() {
+			columns, err := rows.Columns()
+			if err != nil || !isBlankRecord(columns) {
+				return columns, err
+			}
+		}
+		if err := rows.Error(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return nil
+}
+
+// isWorkbook reports whether a zip archive is an XLSX workbook
+func isWorkbook(archive *zip.Reader) bool {
+	for _, entry := range archive.File {
+		if entry.Name == "xl/workbook.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// isBlankRecord reports whether all fields of a record are empty
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != EmptyString {
+			return false
+		}
+	}
+	return true
+}
+
+// sniffDelimiter picks the delimiter occurring most often outside of quotes in the first line
+func sniffDelimiter(head []byte) rune {
+	counts := map[rune]int{}
+	inQuotes := false
+	for _, c := range string(head) {
+		if c == '"' {
+			inQuotes = !inQuotes
+			continue
+		}
+		if inQuotes {
+			continue
+		}
+		if c == '\n' {
+			break
+		}
+		counts[c]++
+	}
+	delimiter := sniffedDelimiters[0]
+	for _, candidate := range sniffedDelimiters[1:] {
+		if counts[candidate] > counts[delimiter] {
+			delimiter = candidate
+		}
+	}
+	return delimiter
+}
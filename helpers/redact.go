@@ -0,0 +1,155 @@
+package helpers
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/paypermint/appkit"
+)
+
+// redacted replaces a masked value in the log output
+const redacted = "[REDACTED]"
+
+// sensitiveKeyParts mask the value of any log key or field name containing them
+var sensitiveKeyParts = []string{
+	"password", "passwd", "secret", "token", "authorization", "api_key",
+	"account_no", "account_number", "bank_account", "gstin", "email", "contact_no", "phone", "mobile",
+}
+
+// sensitivePatterns mask credentials and PII found within logged strings
+var sensitivePatterns = []*regexp.Regexp{
+	// Authorization header values
+	regexp.MustCompile(`\b(Basic|Bearer)\s+[A-Za-z0-9._~+/=-]{8,}`),
+	// email addresses
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	// GSTINs
+	regexp.MustCompile(`\b\d{2}[A-Z]{5}\d{4}[A-Z][1-9A-Z]Z[0-9A-Z]\b`),
+	// Indian phone numbers with country code, bare ten digit numbers are too often document numbers
+	regexp.MustCompile(`\+91[\s-]?[6-9]\d{9}\b`),
+}
+
+//NewRedactingLogger wraps logger so that credentials and PII are masked in the message and in the values of
+//every logged key. Structs, maps and slices are logged as JSON with the values of sensitive fields masked
+func NewRedactingLogger(logger appkit.AppLogger) appkit.AppLogger {
+	if _, ok := logger.(*redactingLogger); ok {
+		return logger
+	}
+	return &redactingLogger{logger: logger}
+}
+
+type redactingLogger struct {
+	logger appkit.AppLogger
+}
+
+func (l *redactingLogger) New(ctx ...interface{}) appkit.AppLogger {
+	return &redactingLogger{logger: l.logger.New(RedactLogContext(ctx)...)}
+}
+
+func (l *redactingLogger) Debug(msg string, ctx ...interface{}) {
+	l.logger.Debug(redactString(msg), RedactLogContext(ctx)...)
+}
+
+func (l *redactingLogger) Info(msg string, ctx ...interface{}) {
+	l.logger.Info(redactString(msg), RedactLogContext(ctx)...)
+}
+
+func (l *redactingLogger) Warn(msg string, ctx ...interface{}) {
+	l.logger.Warn(redactString(msg), RedactLogContext(ctx)...)
+}
+
+func (l *redactingLogger) Error(msg string, ctx ...interface{}) {
+	l.logger.Error(redactString(msg), RedactLogContext(ctx)...)
+}
+
+func (l *redactingLogger) Crit(msg string, ctx ...interface{}) {
+	l.logger.Crit(redactString(msg), RedactLogContext(ctx)...)
+}
+
+//RedactLogContext returns a copy of the key value pairs of a log call with the values masked
+func RedactLogContext(ctx []interface{}) []interface{} {
+	redactedCtx := make([]interface{}, len(ctx))
+	for i := 0; i < len(ctx); i += 2 {
+		key, _ := ctx[i].(string)
+		redactedCtx[i] = ctx[i]
+		if i+1 < len(ctx) {
+			redactedCtx[i+1] = redactValue(key, ctx[i+1])
+		}
+	}
+	return redactedCtx
+}
+
+// redactValue masks a logged value, entirely if its key is sensitive
+func redactValue(key string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if isSensitiveKey(key) {
+		return redacted
+	}
+	switch v := value.(type) {
+	case string:
+		return redactString(v)
+	case error:
+		return redactString(v.Error())
+	case []byte:
+		return redactString(string(v))
+	}
+
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return value
+	}
+	// structs are logged through their JSON so that their fields can be masked by name, unexported fields such as
+	// client credentials are left out
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return redacted
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(jsonValue, &decoded); err != nil {
+		return redacted
+	}
+	return redactJSON(decoded)
+}
+
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSensitiveKey(key) && field != nil && field != EmptyString {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactJSON(field)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSON(item)
+		}
+		return v
+	case string:
+		return redactString(v)
+	}
+	return value
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(strings.NewReplacer("-", "_", " ", "_").Replace(key))
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactString(s string) string {
+	for _, pattern := range sensitivePatterns {
+		s = pattern.ReplaceAllString(s, redacted)
+	}
+	return s
+}
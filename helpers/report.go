@@ -0,0 +1,47 @@
+package helpers
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/paypermint/bridge-app-svc/models"
+)
+
+// columns of a downloaded report. The values of the customer file are left out, they hold contact and bank details
+var customerSyncReportColumns = []string{"row", "merchant_customer_id", "status", "customer_id", "field", "message"}
+
+//IsCustomerSyncStatus returns true if status is a valid customer sync row status
+func IsCustomerSyncStatus(status string) bool {
+	switch status {
+	case CustomerSyncStatusCreated, CustomerSyncStatusUpdated, CustomerSyncStatusUnchanged, CustomerSyncStatusDeactivatedLocally,
+		CustomerSyncStatusSkipped, CustomerSyncStatusFailed:
+		return true
+	}
+	return false
+}
+
+//WriteCustomerSyncReportCSV writes the outcome of every row of the report by row number and merchant_customer_id,
+//so that the failed rows can be found in the customer file, corrected and submitted again.
+//Only rows having the given status are written unless status is empty
+func WriteCustomerSyncReportCSV(w io.Writer, report *models.CustomerSyncReport, status string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(customerSyncReportColumns); err != nil {
+		return err
+	}
+	for _, result := range report.Rows {
+		if status != EmptyString && result.Status != status {
+			continue
+		}
+		row := EmptyString
+		if result.Row > 0 {
+			row = strconv.Itoa(result.Row)
+		}
+		record := []string{row, result.MerchantCustomerID, result.Status, result.CustomerID, result.Field, result.Message}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
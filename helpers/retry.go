@@ -0,0 +1,183 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//RetryPolicy controls how often and how far apart outbound requests are retried
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var (
+	retryPolicyMu sync.RWMutex
+	retryPolicy   = RetryPolicy{MaxAttempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+)
+
+//SetRetryPolicy sets the retry policy of the outbound SAP and payabbhi requests
+func SetRetryPolicy(policy RetryPolicy) {
+	retryPolicyMu.Lock()
+	defer retryPolicyMu.Unlock()
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	retryPolicy = policy
+}
+
+//GetRetryPolicy returns the retry policy of the outbound SAP and payabbhi requests
+func GetRetryPolicy() RetryPolicy {
+	retryPolicyMu.RLock()
+	defer retryPolicyMu.RUnlock()
+	return retryPolicy
+}
+
+// backoff returns the delay before the retry following attempt, drawn at random up to an exponentially
+// growing bound so that clients failing together do not retry together
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	bound := p.MaxDelay
+	if shift := uint(attempt - 1); shift < 32 && p.BaseDelay<<shift < p.MaxDelay {
+		bound = p.BaseDelay << shift
+	}
+	if bound <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(bound)) + 1)
+}
+
+type idempotentKey struct{}
+
+// markIdempotent marks a request as safe to repeat although its method is not, such as a POST reading from SAP
+// or an upsert keyed by the merchant's id
+func markIdempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+// isIdempotent returns true if sending the request twice has the same effect as sending it once
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+// do sends the request through the circuit breaker of the client's upstream and retries it on failures which are
+// likely to pass. Requests the upstream can not have processed, refused connections and 429, are retried regardless
+// of the method. Failures after which the request may have been processed, such as a reset connection or a 502,
+// 503 or 504, are only retried for idempotent requests. Callers bind the request to the client context first
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	idempotent := isIdempotent(req)
+	policy := GetRetryPolicy()
+	breaker := GetCircuitBreaker(c.upstream)
+
+	// a body can only be sent again if it can be recreated
+	rewindable := req.Body == nil || req.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		if err := breaker.Allow(); err != nil {
+			observeUpstreamRejected(c.upstream, req)
+			return nil, err
+		}
+		injectTrace(req)
+		start := time.Now()
+		res, err := c.HTTPClient.Do(req)
+		observeUpstreamRequest(c.upstream, req, res, err, time.Since(start))
+		breaker.Record(isUpstreamFailure(res, err))
+
+		retry, retryAfter := shouldRetry(res, err, idempotent)
+		if !retry || !rewindable || attempt >= policy.MaxAttempts {
+			return res, err
+		}
+		delay := policy.backoff(attempt)
+		if retryAfter > 0 {
+			// the upstream asks for more patience than the policy allows, give up instead of hammering it
+			if retryAfter > policy.MaxDelay {
+				return res, err
+			}
+			delay = retryAfter
+		}
+		if res != nil {
+			io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isUpstreamFailure returns true if the outcome of a request counts against the upstream's circuit breaker,
+// errors in the request itself do not
+func isUpstreamFailure(res *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests
+}
+
+// shouldRetry returns whether the request is to be retried and the delay asked for by a Retry-After header
+func shouldRetry(res *http.Response, err error, idempotent bool) (bool, time.Duration) {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false, 0
+		}
+		if isConnectionRefused(err) {
+			return true, 0
+		}
+		var netErr net.Error
+		return idempotent && (errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+			errors.Is(err, syscall.ECONNRESET)), 0
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests:
+		return true, parseRetryAfter(res.Header.Get("Retry-After"))
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent, parseRetryAfter(res.Header.Get("Retry-After"))
+	}
+	return false, 0
+}
+
+func isConnectionRefused(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as HTTP date, 0 if there is none
+func parseRetryAfter(value string) time.Duration {
+	if value == EmptyString {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
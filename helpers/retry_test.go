@@ -0,0 +1,100 @@
+package helpers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setRetryPolicy(t *testing.T, policy RetryPolicy) {
+	previous := GetRetryPolicy()
+	SetRetryPolicy(policy)
+	t.Cleanup(func() { SetRetryPolicy(previous) })
+}
+
+// newFlakyServer answers the first request with status and the later ones with a customer, calls counts the requests
+func newFlakyServer(t *testing.T, status int) (*httptest.Server, *int32) {
+	calls := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) == 1 {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":200,"data":{"id":"cust_1"}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, calls
+}
+
+func TestClientRetriesIdempotentRequests(t *testing.T) {
+	setRetryPolicy(t, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		send      func(client *Client) error
+		wantCalls int32
+		wantErr   bool
+	}{
+		{
+			name: "marked request",
+			send: func(client *Client) error {
+				_, err := client.UpdateCustomer("cust_1", &CreateCustomerRequest{Name: "A"})
+				return err
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "marked request of a client bound to a context",
+			ctx:  context.Background(),
+			send: func(client *Client) error {
+				_, err := client.UpdateCustomer("cust_1", &CreateCustomerRequest{Name: "A"})
+				return err
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "unmarked request of a client bound to a context",
+			ctx:  context.Background(),
+			send: func(client *Client) error {
+				_, err := client.CreateCustomer(&CreateCustomerRequest{Name: "A"})
+				return err
+			},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := newFlakyServer(t, http.StatusServiceUnavailable)
+			client := &Client{baseURL: server.URL, upstream: "retry_test", HTTPClient: server.Client()}
+			if tt.ctx != nil {
+				client = client.WithContext(tt.ctx)
+			}
+			err := tt.send(client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("send error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Fatalf("send made %d calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientRetriesRefusedRequests(t *testing.T) {
+	setRetryPolicy(t, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+
+	server, calls := newFlakyServer(t, http.StatusTooManyRequests)
+	client := (&Client{baseURL: server.URL, upstream: "retry_test", HTTPClient: server.Client()}).WithContext(context.Background())
+	if _, err := client.CreateCustomer(&CreateCustomerRequest{Name: "A"}); err != nil {
+		t.Fatalf("CreateCustomer() error = %v", err)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Fatalf("CreateCustomer() made %d calls, want 2", got)
+	}
+}
@@ -0,0 +1,171 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/models"
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+//SAP PI RESTAdapter endpoints
+const (
+	sapOpenItemsEndpoint           = "fipaycollectionib"
+	sapPaymentConfirmationEndpoint = "fipayconfirmationib"
+)
+
+var errInvalidSAPResponse = errors.New("invalid format received,Unable to parse")
+
+func init() {
+	RegisterConnector(util.SyncWithSAP, newSAPConnector)
+}
+
+//GetInvoicesFromSapRequest represents struct to get invoices from SAP system
+type GetInvoicesFromSapRequest struct {
+	Records []*SapRecord `json:"Records,omitempty"`
+}
+
+//GetInvoicesFromSapResponse represents struct of invoices received from SAP system
+type GetInvoicesFromSapResponse struct {
+	Records []*SapRecord `json:"Records,omitempty"`
+}
+
+//PostPaymentUpdateRequest represents struct to update payments at SAP end
+type PostPaymentUpdateRequest struct {
+	Records []*SapRecord `json:"Records,omitempty"`
+}
+
+// sapConnector talks to SAP through the PI RESTAdapter
+type sapConnector struct {
+	client *Client
+}
+
+func newSAPConnector(opts *ConnectorOptions) (Connector, error) {
+	profile, err := GetSAPProfile(opts.ProfileID)
+	if err != nil {
+		return nil, err
+	}
+	vClient, err := appkit.VaultConnect(opts.AppCtx, opts.TraceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// sap user credentials of the tenant from vault
+	userid, password, err := vClient.SAPClientCreds(profile.CredsPath)
+	if err != nil {
+		return nil, err
+	}
+	return &sapConnector{
+		client: CreateSAPClient(profile, opts.RemoteAddr, userid, password).WithContext(opts.Context),
+	}, nil
+}
+
+func (s *sapConnector) Name() string {
+	return util.SyncWithSAP
+}
+
+func (s *sapConnector) FetchOpenItems(merchantCustomerID string) ([]ConnectorRecord, error) {
+	response, err := s.client.GetInvoicesFromSap(toGetInvoicesFromSapRequest(merchantCustomerID))
+	if err != nil {
+		return nil, err
+	}
+	return toConnectorRecords(response)
+}
+
+func (s *sapConnector) PostPaymentConfirmations(records []*SapRecord, platform string) (*SAPSuccessResponse, error) {
+	return s.client.PostPaymentUpdateToSAP(toPostPaymentUpdateRequest(records), platform)
+}
+
+func (s *sapConnector) PaymentConfirmationsPayload(records []*SapRecord) interface{} {
+	return toPostPaymentUpdateRequest(records)
+}
+
+// GetInvoicesFromSap calls SAP api for fetching invoices
+func (c *Client) GetInvoicesFromSap(getInvoicesFromSapRequest *GetInvoicesFromSapRequest) (*SAPSuccessResponse, error) {
+	return c.postRecordsToSAP(c.sapEndpoints.OpenItems, getInvoicesFromSapRequest)
+}
+
+func (c *Client) postRecordsToSAP(endpoint string, request interface{}) (*SAPSuccessResponse, error) {
+	jsonValue, _ := json.Marshal(request)
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", c.baseURL, endpoint), bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res := GetInvoicesFromSapResponse{
+		Records: []*SapRecord{},
+	}
+	var response *SAPSuccessResponse
+	// the records endpoints only read from SAP
+	if response, err = c.sendRequestToSAP(markIdempotent(req), res); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// PostPaymentUpdateToSAP calls SAP api for updating payments
+func (c *Client) PostPaymentUpdateToSAP(paymentUpdateRequest *PostPaymentUpdateRequest, platform string) (*SAPSuccessResponse, error) {
+	jsonValue, _ := json.Marshal(paymentUpdateRequest)
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", c.baseURL, c.sapEndpoints.PaymentConfirmation), bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Platform", platform)
+	res := models.PaymentUpdateResponse{
+		Records: &models.StatusRecord{},
+	}
+	var response *SAPSuccessResponse
+	if response, err = c.sendRequestToSAP(req, res); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func toPostPaymentUpdateRequest(records []*SapRecord) *PostPaymentUpdateRequest {
+	return &PostPaymentUpdateRequest{
+		Records: records,
+	}
+}
+
+func toGetInvoicesFromSapRequest(merchantCustomerID string) *GetInvoicesFromSapRequest {
+	return &GetInvoicesFromSapRequest{
+		Records: []*SapRecord{
+			{
+				CustomerID: merchantCustomerID,
+			},
+		},
+	}
+}
+
+func toConnectorRecords(sapResponse *SAPSuccessResponse) ([]ConnectorRecord, error) {
+	sapData, ok := sapResponse.Data.(map[string]interface{})
+	if !ok {
+		return nil, errInvalidSAPResponse
+	}
+	records := []ConnectorRecord{}
+	sapRecordsData, present := sapData[util.KeyRecords]
+	if !present {
+		return records, nil
+	}
+	switch sapRecords := sapRecordsData.(type) {
+	case []interface{}:
+		for _, sapRecord := range sapRecords {
+			if sapRecordObj, ok := sapRecord.(map[string]interface{}); ok {
+				records = append(records, sapRecordObj)
+			}
+		}
+	case map[string]interface{}:
+		// PI collapses a single record into an object instead of an array
+		records = append(records, sapRecords)
+	default:
+		return nil, errInvalidSAPResponse
+	}
+	return records, nil
+}
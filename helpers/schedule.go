@@ -0,0 +1,371 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/models"
+	"github.com/paypermint/bridge-app-svc/util"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	scheduleObject    = "schedule"
+	scheduleRunObject = "schedule_run"
+	// scheduleTimezone is the zone cron expressions are evaluated in, the zoneinfo is bundled with the binary
+	scheduleTimezone = "Asia/Kolkata"
+)
+
+//Schedule modes
+const (
+	// ScheduleModeCustomers fetches the open items of every customer synced for the profile, one request per customer
+	ScheduleModeCustomers = "customers"
+	// ScheduleModeWildcard fetches the open items of all customers with a single request
+	ScheduleModeWildcard = "wildcard"
+)
+
+var (
+	//ErrScheduleNotFound is returned when no schedule exists for a name
+	ErrScheduleNotFound = errors.New("schedule not found")
+	errUnknownCustomer  = errors.New("customer has not been synced")
+)
+
+//InvoiceSchedule pulls the open items of a profile from the ERP into payabbhi invoices on a cron schedule
+type InvoiceSchedule struct {
+	Name      string `json:"name"`
+	ProfileID string `json:"profile_id"`
+	// Cron is a standard five field cron expression or descriptor such as @daily, evaluated in Asia/Kolkata
+	Cron     string `json:"cron"`
+	SyncWith string `json:"sync_with"`
+	Mode     string `json:"mode"`
+	Platform string `json:"platform"`
+	// AccessID and the secret key read from the SecretKeyEnv environment variable authenticate with payabbhi
+	AccessID     string `json:"access_id"`
+	SecretKeyEnv string `json:"secret_key_env"`
+}
+
+//LoadInvoiceSchedules reads a JSON array of invoice schedules
+func LoadInvoiceSchedules(path string) ([]*InvoiceSchedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schedules []*InvoiceSchedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, schedule := range schedules {
+		if err := schedule.validate(); err != nil {
+			return nil, err
+		}
+		if names[schedule.Name] {
+			return nil, fmt.Errorf("invoice schedule %s is defined twice", schedule.Name)
+		}
+		names[schedule.Name] = true
+	}
+	return schedules, nil
+}
+
+func (s *InvoiceSchedule) validate() error {
+	if s.Name == EmptyString || s.ProfileID == EmptyString {
+		return errors.New("invoice schedule needs a name and a profile_id")
+	}
+	if _, err := cron.ParseStandard(s.Cron); err != nil {
+		return fmt.Errorf("invoice schedule %s: %s", s.Name, err.Error())
+	}
+	if s.SyncWith == EmptyString {
+		s.SyncWith = util.SyncWithSAP
+	}
+	if !HasConnector(s.SyncWith) {
+		return fmt.Errorf("invoice schedule %s: %s", s.Name, ErrUnknownConnector.Error())
+	}
+	switch s.Mode {
+	case EmptyString:
+		s.Mode = ScheduleModeCustomers
+	case ScheduleModeCustomers, ScheduleModeWildcard:
+	default:
+		return fmt.Errorf("invoice schedule %s: unknown mode %s", s.Name, s.Mode)
+	}
+	if s.AccessID == EmptyString || s.SecretKeyEnv == EmptyString {
+		return fmt.Errorf("invoice schedule %s needs an access_id and a secret_key_env", s.Name)
+	}
+	if os.Getenv(s.SecretKeyEnv) == EmptyString {
+		return fmt.Errorf("invoice schedule %s: environment variable %s is not set", s.Name, s.SecretKeyEnv)
+	}
+	return nil
+}
+
+// scheduleEntry is a schedule registered with the cron runner
+type scheduleEntry struct {
+	schedule  *InvoiceSchedule
+	entryID   cron.EntryID
+	lastJob   *Job
+	lastRunAt time.Time
+}
+
+//Scheduler submits a sync job for every invoice schedule when it is due
+type Scheduler struct {
+	appCtx  *appkit.AppContext
+	jobs    *JobManager
+	cron    *cron.Cron
+	mu      sync.Mutex
+	entries map[string]*scheduleEntry
+	names   []string
+}
+
+//NewScheduler registers the schedules, they run once Start is called
+func NewScheduler(appCtx *appkit.AppContext, jobs *JobManager, schedules []*InvoiceSchedule) (*Scheduler, error) {
+	location, err := time.LoadLocation(scheduleTimezone)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scheduler{
+		appCtx:  appCtx,
+		jobs:    jobs,
+		cron:    cron.New(cron.WithLocation(location)),
+		entries: map[string]*scheduleEntry{},
+	}
+	for _, schedule := range schedules {
+		entry := &scheduleEntry{schedule: schedule}
+		name := schedule.Name
+		if entry.entryID, err = s.cron.AddFunc(schedule.Cron, func() { s.trigger(name) }); err != nil {
+			return nil, err
+		}
+		s.entries[name] = entry
+		s.names = append(s.names, name)
+	}
+	return s, nil
+}
+
+//Start runs the schedules in the background
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+//Stop stops triggering the schedules, runs already submitted keep running
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+}
+
+//Schedules returns the API structure of every schedule
+func (s *Scheduler) Schedules() []*models.Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := []*models.Schedule{}
+	for _, name := range s.names {
+		entry := s.entries[name]
+		schedules = append(schedules, &models.Schedule{
+			Name:      name,
+			Object:    scheduleObject,
+			ProfileID: entry.schedule.ProfileID,
+			Cron:      entry.schedule.Cron,
+			SyncWith:  entry.schedule.SyncWith,
+			Mode:      entry.schedule.Mode,
+			NextRunAt: unixOrZero(s.cron.Entry(entry.entryID).Next),
+			LastRunAt: unixOrZero(entry.lastRunAt),
+		})
+	}
+	return schedules
+}
+
+//Runs returns the latest runs of a schedule, newest first
+func (s *Scheduler) Runs(name string, limit int) ([]*ScheduleRun, error) {
+	s.mu.Lock()
+	_, ok := s.entries[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	return GetStore().ListScheduleRuns(name, limit)
+}
+
+// trigger submits the sync job of a schedule unless its previous run is still going
+func (s *Scheduler) trigger(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.entries[name]
+	logger := s.appCtx.Logger.New("schedule", name)
+	if entry.lastJob != nil {
+		if status := entry.lastJob.Status(); status == JobStatusQueued || status == JobStatusRunning {
+			logger.Warn("skipping schedule, previous run has not finished", "job_id", entry.lastJob.ID())
+			return
+		}
+	}
+
+	entry.lastRunAt = time.Now()
+	job, err := s.jobs.Submit(context.Background(), entry.schedule.ProfileID, JobTypeInvoiceSchedule, s.pullInvoicesJob(entry.schedule, logger))
+	if err != nil {
+		logger.Error("unable to submit scheduled invoice sync", "error_message", err.Error())
+		id, _ := newJobID()
+		s.saveRun(logger, &ScheduleRun{
+			ID:          id,
+			Schedule:    name,
+			ProfileID:   entry.schedule.ProfileID,
+			Status:      JobStatusFailed,
+			Error:       err.Error(),
+			StartedAt:   entry.lastRunAt,
+			CompletedAt: entry.lastRunAt,
+		})
+		return
+	}
+	entry.lastJob = job
+}
+
+func (s *Scheduler) saveRun(logger appkit.AppLogger, run *ScheduleRun) {
+	if err := GetStore().SaveScheduleRun(run); err != nil {
+		logger.Error("unable to record schedule run", "run_id", run.ID, "error_message", err.Error())
+	}
+}
+
+// pullInvoicesJob returns the job of a schedule run, the run is recorded when it starts and when it finishes
+func (s *Scheduler) pullInvoicesJob(schedule *InvoiceSchedule, logger appkit.AppLogger) JobFunc {
+	return func(ctx context.Context, job *Job) (interface{}, error) {
+		run := &ScheduleRun{
+			ID:        job.ID(),
+			Schedule:  schedule.Name,
+			ProfileID: schedule.ProfileID,
+			Status:    JobStatusRunning,
+			StartedAt: time.Now(),
+		}
+		s.saveRun(logger, run)
+
+		err := s.pullInvoices(ctx, job, schedule, run, logger)
+		run.CompletedAt = time.Now()
+		switch {
+		case ctx.Err() == context.Canceled:
+			run.Status = JobStatusCancelled
+		case err != nil:
+			run.Status = JobStatusFailed
+			run.Error = err.Error()
+		default:
+			run.Status = JobStatusSucceeded
+		}
+		s.saveRun(logger, run)
+		logger.Info("Scheduled invoice sync finished", "status", run.Status, "customers", run.Customers, "items", run.Items, "failed", run.Failed)
+		return run.ToAPIResponse(), err
+	}
+}
+
+// pullInvoices upserts the open items of every known customer of the schedule profile as payabbhi invoices
+func (s *Scheduler) pullInvoices(ctx context.Context, job *Job, schedule *InvoiceSchedule, run *ScheduleRun, logger appkit.AppLogger) error {
+	connector, err := GetConnector(schedule.SyncWith, &ConnectorOptions{
+		Context:   ctx,
+		AppCtx:    s.appCtx,
+		TraceID:   job.ID(),
+		ProfileID: schedule.ProfileID,
+	})
+	if err != nil {
+		return err
+	}
+	customers, err := listActiveCustomers(schedule.ProfileID)
+	if err != nil {
+		return err
+	}
+	payabbhiClient := NewClient(&BasicAuthCreds{
+		accessID:  schedule.AccessID,
+		secretKey: os.Getenv(schedule.SecretKeyEnv),
+	}, nil, EmptyString).WithContext(ctx)
+
+	syncReq := func(customer *SyncedCustomer) *InvoiceSyncRequest {
+		return &InvoiceSyncRequest{
+			ProfileID:          schedule.ProfileID,
+			SyncWith:           schedule.SyncWith,
+			MerchantCustomerID: customer.MerchantCustomerID,
+			Params:             map[string]string{util.KeyCustomerID: customer.CustomerID},
+			Platform:           schedule.Platform,
+			Logger:             logger,
+		}
+	}
+
+	if schedule.Mode == ScheduleModeWildcard {
+		openItems, err := connector.FetchOpenItems(AllCustomers)
+		if err != nil {
+			return err
+		}
+		known := map[string]*SyncedCustomer{}
+		for _, customer := range customers {
+			known[customer.MerchantCustomerID] = customer
+		}
+		pulled := map[string]bool{}
+		job.AddTotal(len(openItems))
+		for _, openItem := range openItems {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			item, _ := GetStringInterfaceParam(openItem, util.KeySapItem, true)
+			customerNumber, _ := GetStringInterfaceParam(openItem, util.KeySapCustomerNumber, true)
+			customer, ok := known[customerNumber]
+			if !ok {
+				run.Items++
+				run.Failed++
+				job.RecordFailed(item, util.KeySapCustomerNumber, errUnknownCustomer)
+				continue
+			}
+			pulled[customerNumber] = true
+			run.Customers = len(pulled)
+			s.pushOpenItem(payabbhiClient, syncReq(customer), job, run, item, openItem)
+		}
+		return nil
+	}
+
+	for _, customer := range customers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		openItems, err := connector.FetchOpenItems(customer.MerchantCustomerID)
+		if err == ErrCircuitOpen {
+			// every further customer would fail the same way
+			return err
+		}
+		run.Customers++
+		if err != nil {
+			run.Failed++
+			job.AddTotal(1)
+			job.RecordFailed(customer.MerchantCustomerID, util.KeyMerchantCustomerID, err)
+			continue
+		}
+		job.AddTotal(len(openItems))
+		for _, openItem := range openItems {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			item, _ := GetStringInterfaceParam(openItem, util.KeySapItem, true)
+			s.pushOpenItem(payabbhiClient, syncReq(customer), job, run, item, openItem)
+		}
+	}
+	return nil
+}
+
+// listActiveCustomers returns the synced customers of a profile which have not been deactivated
+func listActiveCustomers(profileID string) ([]*SyncedCustomer, error) {
+	customers, err := GetStore().ListCustomers(profileID)
+	if err != nil {
+		return nil, err
+	}
+	active := []*SyncedCustomer{}
+	for _, customer := range customers {
+		if !customer.Deactivated {
+			active = append(active, customer)
+		}
+	}
+	return active, nil
+}
+
+func (s *Scheduler) pushOpenItem(payabbhiClient *Client, syncReq *InvoiceSyncRequest, job *Job, run *ScheduleRun, item string, openItem ConnectorRecord) {
+	run.Items++
+	previewItem, err := pushInvoiceToPayabbhi(payabbhiClient, syncReq, openItem)
+	if err != nil {
+		syncReq.Logger.Error(err.Error(), "item", item)
+		run.Failed++
+		job.RecordFailed(item, previewItem.Field, err)
+		return
+	}
+	job.RecordProcessed()
+}
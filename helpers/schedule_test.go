@@ -0,0 +1,203 @@
+package helpers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+// nopLogger discards what is logged, the methods the helpers do not call are left to the embedded nil logger
+type nopLogger struct {
+	appkit.AppLogger
+}
+
+func (l nopLogger) New(ctx ...interface{}) appkit.AppLogger { return l }
+func (nopLogger) Debug(msg string, ctx ...interface{})      {}
+func (nopLogger) Info(msg string, ctx ...interface{})       {}
+func (nopLogger) Warn(msg string, ctx ...interface{})       {}
+func (nopLogger) Error(msg string, ctx ...interface{})      {}
+func (nopLogger) Crit(msg string, ctx ...interface{})       {}
+
+func writeSchedules(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadInvoiceSchedules(t *testing.T) {
+	t.Setenv("SCHEDULE_TEST_SECRET", "secret")
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "five fields",
+			content: `[{"name":"nightly","profile_id":"p1","cron":"30 2 * * *","access_id":"a","secret_key_env":"SCHEDULE_TEST_SECRET"}]`,
+		},
+		{
+			name:    "descriptor",
+			content: `[{"name":"nightly","profile_id":"p1","cron":"@daily","access_id":"a","secret_key_env":"SCHEDULE_TEST_SECRET"}]`,
+		},
+		{
+			name:    "seconds field",
+			content: `[{"name":"nightly","profile_id":"p1","cron":"0 30 2 * * *","access_id":"a","secret_key_env":"SCHEDULE_TEST_SECRET"}]`,
+			wantErr: "invoice schedule nightly:",
+		},
+		{
+			name:    "invalid cron",
+			content: `[{"name":"nightly","profile_id":"p1","cron":"61 * * * *","access_id":"a","secret_key_env":"SCHEDULE_TEST_SECRET"}]`,
+			wantErr: "invoice schedule nightly:",
+		},
+		{
+			name:    "unknown mode",
+			content: `[{"name":"nightly","profile_id":"p1","cron":"@daily","mode":"all","access_id":"a","secret_key_env":"SCHEDULE_TEST_SECRET"}]`,
+			wantErr: "unknown mode all",
+		},
+		{
+			name:    "secret key env not set",
+			content: `[{"name":"nightly","profile_id":"p1","cron":"@daily","access_id":"a","secret_key_env":"SCHEDULE_TEST_UNSET"}]`,
+			wantErr: "environment variable SCHEDULE_TEST_UNSET is not set",
+		},
+		{
+			name: "defined twice",
+			content: `[{"name":"nightly","profile_id":"p1","cron":"@daily","access_id":"a","secret_key_env":"SCHEDULE_TEST_SECRET"},
+				{"name":"nightly","profile_id":"p2","cron":"@hourly","access_id":"a","secret_key_env":"SCHEDULE_TEST_SECRET"}]`,
+			wantErr: "defined twice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedules, err := LoadInvoiceSchedules(writeSchedules(t, tt.content))
+			if tt.wantErr != EmptyString {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadInvoiceSchedules() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadInvoiceSchedules() error = %v", err)
+			}
+			if len(schedules) != 1 || schedules[0].Mode != ScheduleModeCustomers || schedules[0].SyncWith == EmptyString {
+				t.Fatalf("LoadInvoiceSchedules() = %+v, want one schedule with the default mode and sync_with", schedules)
+			}
+		})
+	}
+}
+
+func waitForJob(t *testing.T, job *Job) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job.mu.RLock()
+		finished := job.isFinished()
+		job.mu.RUnlock()
+		if finished {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s did not finish, status %s", job.ID(), job.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newTestScheduler(t *testing.T) (*Scheduler, *JobManager) {
+	SetStore(NewMemoryStore())
+	jobs := NewJobManager(nopLogger{}, 2, 10, time.Hour)
+	scheduler, err := NewScheduler(&appkit.AppContext{Logger: nopLogger{}}, jobs, []*InvoiceSchedule{{
+		Name:         "nightly",
+		ProfileID:    "p1",
+		Cron:         "@daily",
+		SyncWith:     util.SyncWithSAP,
+		Mode:         ScheduleModeCustomers,
+		AccessID:     "a",
+		SecretKeyEnv: "SCHEDULE_TEST_SECRET",
+	}})
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+	return scheduler, jobs
+}
+
+func TestSchedulerSkipsOverlappingRun(t *testing.T) {
+	scheduler, jobs := newTestScheduler(t)
+
+	release := make(chan struct{})
+	previous, err := jobs.Submit(context.Background(), "p1", JobTypeInvoiceSchedule, func(ctx context.Context, job *Job) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	scheduler.entries["nightly"].lastJob = previous
+
+	scheduler.trigger("nightly")
+	if scheduler.entries["nightly"].lastJob != previous {
+		t.Fatal("trigger() submitted a run while the previous run was going")
+	}
+	if runs, _ := scheduler.Runs("nightly", 10); len(runs) != 0 {
+		t.Fatalf("Runs() = %d runs, want none for a skipped trigger", len(runs))
+	}
+
+	close(release)
+	waitForJob(t, previous)
+	scheduler.trigger("nightly")
+	next := scheduler.entries["nightly"].lastJob
+	if next == previous {
+		t.Fatal("trigger() did not submit a run once the previous run finished")
+	}
+	waitForJob(t, next)
+}
+
+func TestSchedulerRunHistory(t *testing.T) {
+	scheduler, _ := newTestScheduler(t)
+
+	// no SAP system is configured for the profile, the run fails when creating the connector
+	scheduler.trigger("nightly")
+	job := scheduler.entries["nightly"].lastJob
+	waitForJob(t, job)
+
+	runs, err := scheduler.Runs("nightly", 10)
+	if err != nil {
+		t.Fatalf("Runs() error = %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("Runs() = %d runs, want 1", len(runs))
+	}
+	run := runs[0]
+	if run.ID != job.ID() || run.ProfileID != "p1" || run.Status != JobStatusFailed || run.Error != ErrUnknownTenant.Error() ||
+		run.CompletedAt.IsZero() {
+		t.Fatalf("Runs()[0] = %+v, want the failed run of job %s", run, job.ID())
+	}
+
+	started := time.Now()
+	for i, id := range []string{"run_1", "run_2", "run_3"} {
+		GetStore().SaveScheduleRun(&ScheduleRun{
+			ID:        id,
+			Schedule:  "nightly",
+			Status:    JobStatusSucceeded,
+			StartedAt: started.Add(time.Duration(i+1) * time.Minute),
+		})
+	}
+	runs, err = scheduler.Runs("nightly", 2)
+	if err != nil {
+		t.Fatalf("Runs() error = %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != "run_3" || runs[1].ID != "run_2" {
+		t.Fatalf("Runs() with limit 2 = %+v, want run_3 and run_2", runs)
+	}
+
+	if _, err := scheduler.Runs("weekly", 10); err != ErrScheduleNotFound {
+		t.Fatalf("Runs() of an unknown schedule error = %v, want %v", err, ErrScheduleNotFound)
+	}
+}
@@ -0,0 +1,123 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	stagedFilePrefix = "upl_"
+	// sniffLen is the number of bytes http.DetectContentType considers
+	sniffLen = 512
+)
+
+var (
+	stagingDir    = filepath.Join(os.TempDir(), "bridge-app-svc")
+	maxUploadSize = int64(20 << 20)
+)
+
+var (
+	//ErrUploadTooLarge is returned when an upload exceeds the maximum upload size
+	ErrUploadTooLarge = errors.New("upload exceeds the maximum size")
+	//ErrUnsupportedContent is returned when an upload does not look like a supported file
+	ErrUnsupportedContent = errors.New("unsupported file content")
+	//ErrInvalidStagedFile is returned for a file reference outside of the staging area
+	ErrInvalidStagedFile = errors.New("file is not in the staging area")
+)
+
+// sniffed content types accepted for customer files, compressed files are unpacked by the RecordIterator
+var stageableContentTypes = []string{"text/plain", "text/csv", "application/x-gzip", "application/zip"}
+
+//SetStagingConfig sets the directory uploads are staged in and the maximum size of an upload
+func SetStagingConfig(dir string, maxSize int64) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	stagingDir = dir
+	maxUploadSize = maxSize
+	return nil
+}
+
+//GetMaxUploadSize gets the maximum size of an upload
+func GetMaxUploadSize() int64 {
+	return maxUploadSize
+}
+
+//StageUpload streams an upload into the staging area and returns the name of the staged file
+func StageUpload(r io.Reader) (string, error) {
+	buffered := bufio.NewReaderSize(r, sniffLen)
+	head, err := buffered.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return EmptyString, err
+	}
+	if len(head) == 0 {
+		return EmptyString, ErrUnsupportedContent
+	}
+	if !isStageableContent(head) {
+		return EmptyString, ErrUnsupportedContent
+	}
+
+	name, err := newStagedFileName()
+	if err != nil {
+		return EmptyString, err
+	}
+	path := filepath.Join(stagingDir, name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return EmptyString, err
+	}
+	written, err := io.Copy(file, io.LimitReader(buffered, maxUploadSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > maxUploadSize {
+		err = ErrUploadTooLarge
+	}
+	if err != nil {
+		os.Remove(path)
+		return EmptyString, err
+	}
+	return name, nil
+}
+
+//ResolveStagedFile returns the path of a staged file, rejecting references outside of the staging area
+func ResolveStagedFile(name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasPrefix(name, stagedFilePrefix) {
+		return EmptyString, ErrInvalidStagedFile
+	}
+	return filepath.Join(stagingDir, name), nil
+}
+
+//RemoveStagedFile deletes a staged file
+func RemoveStagedFile(name string) error {
+	path, err := ResolveStagedFile(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func isStageableContent(head []byte) bool {
+	contentType := http.DetectContentType(head)
+	for _, stageable := range stageableContentTypes {
+		if strings.HasPrefix(contentType, stageable) {
+			return true
+		}
+	}
+	return false
+}
+
+func newStagedFileName() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return EmptyString, err
+	}
+	return stagedFilePrefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,155 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/paypermint/bridge-app-svc/models"
+)
+
+//ErrNotFound is returned by a Store when no entry exists for the given key
+var ErrNotFound = errors.New("not found")
+
+//SyncedCustomer records a merchant customer which has been created in payabbhi
+type SyncedCustomer struct {
+	ProfileID          string
+	MerchantCustomerID string
+	CustomerID         string
+	Fingerprint        string
+	// Payload is the JSON of the request last sent
+	Payload string
+	// Deactivated is set once the customer has been deactivated for being blocked or removed from the customer file
+	Deactivated bool
+	SyncedAt    time.Time
+}
+
+//SyncedInvoice records an ERP item which has been pushed as payabbhi invoice
+type SyncedInvoice struct {
+	ProfileID          string
+	Item               string
+	MerchantInvoiceID  string
+	InvoiceID          string
+	MerchantCustomerID string
+	Fingerprint        string
+	// Payload is the JSON of the request last sent
+	Payload  string
+	SyncedAt time.Time
+}
+
+//PaymentPostingStatusPending is the status of a payment confirmation claimed for posting whose ERP response is outstanding
+const PaymentPostingStatusPending = "pending"
+
+//PaymentPosting records a payment confirmation which has been posted to the ERP
+type PaymentPosting struct {
+	ProfileID      string
+	TransactionRef string
+	CompanyCode    string
+	Status         string
+	// Result is the JSON of the ERP response, empty while the posting is pending
+	Result string
+	// PostedAt is the time the posting was claimed at while it is pending
+	PostedAt time.Time
+}
+
+//ToAPIResponse returns the API structure of the posting
+func (p *PaymentPosting) ToAPIResponse() *models.PaymentPosting {
+	return &models.PaymentPosting{
+		TransactionRef: p.TransactionRef,
+		CompanyCode:    p.CompanyCode,
+		Status:         p.Status,
+		PostedAt:       p.PostedAt.Unix(),
+	}
+}
+
+//Response returns the ERP response the posting was recorded with
+func (p *PaymentPosting) Response() (*SAPSuccessResponse, error) {
+	response := &SAPSuccessResponse{}
+	if err := json.Unmarshal([]byte(p.Result), response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+//SyncedObject records a version of a bucket object whose customers have been synced
+type SyncedObject struct {
+	Bucket   string
+	Key      string
+	ETag     string
+	SyncedAt time.Time
+}
+
+//ScheduleRun records a run of an invoice schedule
+type ScheduleRun struct {
+	ID        string
+	Schedule  string
+	ProfileID string
+	Status    string
+	Customers int
+	Items     int
+	Failed    int
+	Error     string
+	// StartedAt is when the run was triggered, CompletedAt is zero while it runs
+	StartedAt   time.Time
+	CompletedAt time.Time
+}
+
+//ToAPIResponse returns the API structure of the run
+func (r *ScheduleRun) ToAPIResponse() *models.ScheduleRun {
+	return &models.ScheduleRun{
+		ID:          r.ID,
+		Object:      scheduleRunObject,
+		Schedule:    r.Schedule,
+		ProfileID:   r.ProfileID,
+		Status:      r.Status,
+		Customers:   r.Customers,
+		Items:       r.Items,
+		Failed:      r.Failed,
+		Error:       r.Error,
+		StartedAt:   r.StartedAt.Unix(),
+		CompletedAt: unixOrZero(r.CompletedAt),
+	}
+}
+
+//Store persists the sync state so that repeated syncs only push what changed
+type Store interface {
+	GetCustomer(profileID, merchantCustomerID string) (*SyncedCustomer, error)
+	// ListCustomers returns the customers synced for a profile ordered by merchant customer id
+	ListCustomers(profileID string) ([]*SyncedCustomer, error)
+	SaveCustomer(customer *SyncedCustomer) error
+	GetInvoice(profileID, item string) (*SyncedInvoice, error)
+	SaveInvoice(invoice *SyncedInvoice) error
+	GetPaymentPosting(profileID, transactionRef, companyCode string) (*PaymentPosting, error)
+	SavePaymentPosting(posting *PaymentPosting) error
+	// ClaimPaymentPosting inserts the posting unless one exists for its key, the existing posting is returned then.
+	// A pending posting claimed before staleBefore is replaced, its claimant is taken to have failed
+	ClaimPaymentPosting(posting *PaymentPosting, staleBefore time.Time) (*PaymentPosting, error)
+	DeletePaymentPosting(profileID, transactionRef, companyCode string) error
+	GetSyncedObject(bucket, key string) (*SyncedObject, error)
+	SaveSyncedObject(object *SyncedObject) error
+	SaveScheduleRun(run *ScheduleRun) error
+	// ListScheduleRuns returns the latest runs of a schedule, newest first
+	ListScheduleRuns(schedule string, limit int) ([]*ScheduleRun, error)
+	Close() error
+}
+
+var store Store = NewMemoryStore()
+
+//SetStore sets the sync state store to be used in helpers
+func SetStore(s Store) {
+	store = s
+}
+
+//GetStore gets the sync state store
+func GetStore() Store {
+	return store
+}
+
+// fingerprint returns a digest of the payload sent for an entity, used to detect changes between syncs
+func fingerprint(v interface{}) string {
+	jsonValue, _ := json.Marshal(v)
+	sum := sha256.Sum256(jsonValue)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,171 @@
+package helpers
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store keeping the sync state in process memory, the state is lost on restart
+type MemoryStore struct {
+	mu        sync.RWMutex
+	customers map[[2]string]SyncedCustomer
+	invoices  map[[2]string]SyncedInvoice
+	postings  map[[3]string]PaymentPosting
+	objects   map[[2]string]SyncedObject
+	runs      map[string]ScheduleRun
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		customers: map[[2]string]SyncedCustomer{},
+		invoices:  map[[2]string]SyncedInvoice{},
+		postings:  map[[3]string]PaymentPosting{},
+		objects:   map[[2]string]SyncedObject{},
+		runs:      map[string]ScheduleRun{},
+	}
+}
+
+//GetCustomer returns the synced customer for a merchant customer id
+func (m *MemoryStore) GetCustomer(profileID, merchantCustomerID string) (*SyncedCustomer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if customer, ok := m.customers[[2]string{profileID, merchantCustomerID}]; ok {
+		return &customer, nil
+	}
+	return nil, ErrNotFound
+}
+
+//ListCustomers returns the customers synced for a profile ordered by merchant customer id
+func (m *MemoryStore) ListCustomers(profileID string) ([]*SyncedCustomer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	customers := []*SyncedCustomer{}
+	for key, customer := range m.customers {
+		if key[0] == profileID {
+			customer := customer
+			customers = append(customers, &customer)
+		}
+	}
+	sort.Slice(customers, func(i, j int) bool {
+		return customers[i].MerchantCustomerID < customers[j].MerchantCustomerID
+	})
+	return customers, nil
+}
+
+//SaveCustomer inserts or replaces a synced customer
+func (m *MemoryStore) SaveCustomer(customer *SyncedCustomer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.customers[[2]string{customer.ProfileID, customer.MerchantCustomerID}] = *customer
+	return nil
+}
+
+//GetInvoice returns the synced invoice for an ERP item
+func (m *MemoryStore) GetInvoice(profileID, item string) (*SyncedInvoice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if invoice, ok := m.invoices[[2]string{profileID, item}]; ok {
+		return &invoice, nil
+	}
+	return nil, ErrNotFound
+}
+
+//SaveInvoice inserts or replaces a synced invoice
+func (m *MemoryStore) SaveInvoice(invoice *SyncedInvoice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.invoices[[2]string{invoice.ProfileID, invoice.Item}] = *invoice
+	return nil
+}
+
+//GetPaymentPosting returns the posting of a payment confirmation
+func (m *MemoryStore) GetPaymentPosting(profileID, transactionRef, companyCode string) (*PaymentPosting, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if posting, ok := m.postings[[3]string{profileID, transactionRef, companyCode}]; ok {
+		return &posting, nil
+	}
+	return nil, ErrNotFound
+}
+
+//SavePaymentPosting inserts or replaces the posting of a payment confirmation
+func (m *MemoryStore) SavePaymentPosting(posting *PaymentPosting) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.postings[[3]string{posting.ProfileID, posting.TransactionRef, posting.CompanyCode}] = *posting
+	return nil
+}
+
+//ClaimPaymentPosting inserts the posting unless one exists for its key, the existing posting is returned then. A
+//pending posting claimed before staleBefore is replaced
+func (m *MemoryStore) ClaimPaymentPosting(posting *PaymentPosting, staleBefore time.Time) (*PaymentPosting, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := [3]string{posting.ProfileID, posting.TransactionRef, posting.CompanyCode}
+	if existing, ok := m.postings[key]; ok && !(existing.Status == PaymentPostingStatusPending && existing.PostedAt.Before(staleBefore)) {
+		return &existing, nil
+	}
+	m.postings[key] = *posting
+	return nil, nil
+}
+
+//DeletePaymentPosting removes the posting of a payment confirmation
+func (m *MemoryStore) DeletePaymentPosting(profileID, transactionRef, companyCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.postings, [3]string{profileID, transactionRef, companyCode})
+	return nil
+}
+
+//GetSyncedObject returns the synced version of a bucket object
+func (m *MemoryStore) GetSyncedObject(bucket, key string) (*SyncedObject, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if object, ok := m.objects[[2]string{bucket, key}]; ok {
+		return &object, nil
+	}
+	return nil, ErrNotFound
+}
+
+//SaveSyncedObject inserts or replaces the synced version of a bucket object
+func (m *MemoryStore) SaveSyncedObject(object *SyncedObject) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[[2]string{object.Bucket, object.Key}] = *object
+	return nil
+}
+
+//SaveScheduleRun inserts or replaces the run of a schedule
+func (m *MemoryStore) SaveScheduleRun(run *ScheduleRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[run.ID] = *run
+	return nil
+}
+
+//ListScheduleRuns returns the latest runs of a schedule, newest first
+func (m *MemoryStore) ListScheduleRuns(schedule string, limit int) ([]*ScheduleRun, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	runs := []*ScheduleRun{}
+	for _, run := range m.runs {
+		if run.Schedule == schedule {
+			run := run
+			runs = append(runs, &run)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+//Close is a no-op for the MemoryStore
+func (m *MemoryStore) Close() error {
+	return nil
+}
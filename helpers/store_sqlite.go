@@ -0,0 +1,290 @@
+package helpers
+
+import (
+	"database/sql"
+	"time"
+
+	// registers the pure go sqlite driver, the service is built with CGO disabled
+	_ "modernc.org/sqlite"
+)
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS synced_customers (
+		profile_id           TEXT    NOT NULL,
+		merchant_customer_id TEXT    NOT NULL,
+		customer_id          TEXT    NOT NULL,
+		fingerprint          TEXT    NOT NULL,
+		payload              TEXT    NOT NULL,
+		deactivated          INTEGER NOT NULL,
+		synced_at            INTEGER NOT NULL,
+		PRIMARY KEY (profile_id, merchant_customer_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS synced_invoices (
+		profile_id           TEXT    NOT NULL,
+		item                 TEXT    NOT NULL,
+		merchant_invoice_id  TEXT    NOT NULL,
+		invoice_id           TEXT    NOT NULL,
+		merchant_customer_id TEXT    NOT NULL,
+		fingerprint          TEXT    NOT NULL,
+		payload              TEXT    NOT NULL,
+		synced_at            INTEGER NOT NULL,
+		PRIMARY KEY (profile_id, item)
+	)`,
+	`CREATE TABLE IF NOT EXISTS payment_postings (
+		profile_id      TEXT    NOT NULL,
+		transaction_ref TEXT    NOT NULL,
+		company_code    TEXT    NOT NULL,
+		status          TEXT    NOT NULL,
+		result          TEXT    NOT NULL,
+		posted_at       INTEGER NOT NULL,
+		PRIMARY KEY (profile_id, transaction_ref, company_code)
+	)`,
+	`CREATE TABLE IF NOT EXISTS synced_objects (
+		bucket    TEXT    NOT NULL,
+		key       TEXT    NOT NULL,
+		etag      TEXT    NOT NULL,
+		synced_at INTEGER NOT NULL,
+		PRIMARY KEY (bucket, key)
+	)`,
+	`CREATE TABLE IF NOT EXISTS schedule_runs (
+		id           TEXT    NOT NULL PRIMARY KEY,
+		schedule     TEXT    NOT NULL,
+		profile_id   TEXT    NOT NULL,
+		status       TEXT    NOT NULL,
+		customers    INTEGER NOT NULL,
+		items        INTEGER NOT NULL,
+		failed       INTEGER NOT NULL,
+		error        TEXT    NOT NULL,
+		started_at   INTEGER NOT NULL,
+		completed_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS schedule_runs_schedule ON schedule_runs (schedule, started_at)`,
+}
+
+// SQLiteStore is a Store persisting the sync state in an embedded SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens or creates the SQLite database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows a single writer, serialise access instead of failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	for _, stmt := range append([]string{"PRAGMA journal_mode=WAL"}, sqliteSchema...) {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+//GetCustomer returns the synced customer for a merchant customer id
+func (s *SQLiteStore) GetCustomer(profileID, merchantCustomerID string) (*SyncedCustomer, error) {
+	customer := &SyncedCustomer{}
+	var syncedAt int64
+	err := s.db.QueryRow(`SELECT profile_id, merchant_customer_id, customer_id, fingerprint, payload, deactivated, synced_at
+		FROM synced_customers WHERE profile_id = ? AND merchant_customer_id = ?`, profileID, merchantCustomerID).
+		Scan(&customer.ProfileID, &customer.MerchantCustomerID, &customer.CustomerID, &customer.Fingerprint, &customer.Payload, &customer.Deactivated, &syncedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	customer.SyncedAt = time.Unix(syncedAt, 0)
+	return customer, nil
+}
+
+//ListCustomers returns the customers synced for a profile ordered by merchant customer id
+func (s *SQLiteStore) ListCustomers(profileID string) ([]*SyncedCustomer, error) {
+	rows, err := s.db.Query(`SELECT profile_id, merchant_customer_id, customer_id, fingerprint, payload, deactivated, synced_at
+		FROM synced_customers WHERE profile_id = ? ORDER BY merchant_customer_id`, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	customers := []*SyncedCustomer{}
+	for rows.Next() {
+		customer := &SyncedCustomer{}
+		var syncedAt int64
+		if err := rows.Scan(&customer.ProfileID, &customer.MerchantCustomerID, &customer.CustomerID, &customer.Fingerprint, &customer.Payload, &customer.Deactivated, &syncedAt); err != nil {
+			return nil, err
+		}
+		customer.SyncedAt = time.Unix(syncedAt, 0)
+		customers = append(customers, customer)
+	}
+	return customers, rows.Err()
+}
+
+//SaveCustomer inserts or replaces a synced customer
+func (s *SQLiteStore) SaveCustomer(customer *SyncedCustomer) error {
+	_, err := s.db.Exec(`INSERT INTO synced_customers (profile_id, merchant_customer_id, customer_id, fingerprint, payload, deactivated, synced_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (profile_id, merchant_customer_id) DO UPDATE SET
+		customer_id = excluded.customer_id, fingerprint = excluded.fingerprint, payload = excluded.payload,
+		deactivated = excluded.deactivated, synced_at = excluded.synced_at`,
+		customer.ProfileID, customer.MerchantCustomerID, customer.CustomerID, customer.Fingerprint, customer.Payload, customer.Deactivated, customer.SyncedAt.Unix())
+	return err
+}
+
+//GetInvoice returns the synced invoice for an ERP item
+func (s *SQLiteStore) GetInvoice(profileID, item string) (*SyncedInvoice, error) {
+	invoice := &SyncedInvoice{}
+	var syncedAt int64
+	err := s.db.QueryRow(`SELECT profile_id, item, merchant_invoice_id, invoice_id, merchant_customer_id, fingerprint, payload, synced_at
+		FROM synced_invoices WHERE profile_id = ? AND item = ?`, profileID, item).
+		Scan(&invoice.ProfileID, &invoice.Item, &invoice.MerchantInvoiceID, &invoice.InvoiceID, &invoice.MerchantCustomerID, &invoice.Fingerprint, &invoice.Payload, &syncedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	invoice.SyncedAt = time.Unix(syncedAt, 0)
+	return invoice, nil
+}
+
+//SaveInvoice inserts or replaces a synced invoice
+func (s *SQLiteStore) SaveInvoice(invoice *SyncedInvoice) error {
+	_, err := s.db.Exec(`INSERT INTO synced_invoices (profile_id, item, merchant_invoice_id, invoice_id, merchant_customer_id, fingerprint, payload, synced_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (profile_id, item) DO UPDATE SET
+		merchant_invoice_id = excluded.merchant_invoice_id, invoice_id = excluded.invoice_id,
+		merchant_customer_id = excluded.merchant_customer_id, fingerprint = excluded.fingerprint,
+		payload = excluded.payload, synced_at = excluded.synced_at`,
+		invoice.ProfileID, invoice.Item, invoice.MerchantInvoiceID, invoice.InvoiceID, invoice.MerchantCustomerID, invoice.Fingerprint, invoice.Payload, invoice.SyncedAt.Unix())
+	return err
+}
+
+//GetPaymentPosting returns the posting of a payment confirmation
+func (s *SQLiteStore) GetPaymentPosting(profileID, transactionRef, companyCode string) (*PaymentPosting, error) {
+	posting := &PaymentPosting{}
+	var postedAt int64
+	err := s.db.QueryRow(`SELECT profile_id, transaction_ref, company_code, status, result, posted_at
+		FROM payment_postings WHERE profile_id = ? AND transaction_ref = ? AND company_code = ?`, profileID, transactionRef, companyCode).
+		Scan(&posting.ProfileID, &posting.TransactionRef, &posting.CompanyCode, &posting.Status, &posting.Result, &postedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	posting.PostedAt = time.Unix(postedAt, 0)
+	return posting, nil
+}
+
+//SavePaymentPosting inserts or replaces the posting of a payment confirmation
+func (s *SQLiteStore) SavePaymentPosting(posting *PaymentPosting) error {
+	_, err := s.db.Exec(`INSERT INTO payment_postings (profile_id, transaction_ref, company_code, status, result, posted_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (profile_id, transaction_ref, company_code) DO UPDATE SET
+		status = excluded.status, result = excluded.result, posted_at = excluded.posted_at`,
+		posting.ProfileID, posting.TransactionRef, posting.CompanyCode, posting.Status, posting.Result, posting.PostedAt.Unix())
+	return err
+}
+
+//ClaimPaymentPosting inserts the posting unless one exists for its key, the existing posting is returned then. A
+//pending posting claimed before staleBefore is replaced
+func (s *SQLiteStore) ClaimPaymentPosting(posting *PaymentPosting, staleBefore time.Time) (*PaymentPosting, error) {
+	result, err := s.db.Exec(`INSERT INTO payment_postings (profile_id, transaction_ref, company_code, status, result, posted_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (profile_id, transaction_ref, company_code) DO UPDATE SET
+		status = excluded.status, result = excluded.result, posted_at = excluded.posted_at
+		WHERE payment_postings.status = ? AND payment_postings.posted_at < ?`,
+		posting.ProfileID, posting.TransactionRef, posting.CompanyCode, posting.Status, posting.Result, posting.PostedAt.Unix(),
+		PaymentPostingStatusPending, staleBefore.Unix())
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if claimed == 1 {
+		return nil, nil
+	}
+	return s.GetPaymentPosting(posting.ProfileID, posting.TransactionRef, posting.CompanyCode)
+}
+
+//DeletePaymentPosting removes the posting of a payment confirmation
+func (s *SQLiteStore) DeletePaymentPosting(profileID, transactionRef, companyCode string) error {
+	_, err := s.db.Exec(`DELETE FROM payment_postings WHERE profile_id = ? AND transaction_ref = ? AND company_code = ?`,
+		profileID, transactionRef, companyCode)
+	return err
+}
+
+//GetSyncedObject returns the synced version of a bucket object
+func (s *SQLiteStore) GetSyncedObject(bucket, key string) (*SyncedObject, error) {
+	object := &SyncedObject{}
+	var syncedAt int64
+	err := s.db.QueryRow(`SELECT bucket, key, etag, synced_at
+		FROM synced_objects WHERE bucket = ? AND key = ?`, bucket, key).
+		Scan(&object.Bucket, &object.Key, &object.ETag, &syncedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	object.SyncedAt = time.Unix(syncedAt, 0)
+	return object, nil
+}
+
+//SaveSyncedObject inserts or replaces the synced version of a bucket object
+func (s *SQLiteStore) SaveSyncedObject(object *SyncedObject) error {
+	_, err := s.db.Exec(`INSERT INTO synced_objects (bucket, key, etag, synced_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (bucket, key) DO UPDATE SET
+		etag = excluded.etag, synced_at = excluded.synced_at`,
+		object.Bucket, object.Key, object.ETag, object.SyncedAt.Unix())
+	return err
+}
+
+//SaveScheduleRun inserts or replaces the run of a schedule
+func (s *SQLiteStore) SaveScheduleRun(run *ScheduleRun) error {
+	var completedAt int64
+	if !run.CompletedAt.IsZero() {
+		completedAt = run.CompletedAt.Unix()
+	}
+	_, err := s.db.Exec(`INSERT INTO schedule_runs (id, schedule, profile_id, status, customers, items, failed, error, started_at, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+		status = excluded.status, customers = excluded.customers, items = excluded.items, failed = excluded.failed,
+		error = excluded.error, completed_at = excluded.completed_at`,
+		run.ID, run.Schedule, run.ProfileID, run.Status, run.Customers, run.Items, run.Failed, run.Error, run.StartedAt.Unix(), completedAt)
+	return err
+}
+
+//ListScheduleRuns returns the latest runs of a schedule, newest first
+func (s *SQLiteStore) ListScheduleRuns(schedule string, limit int) ([]*ScheduleRun, error) {
+	rows, err := s.db.Query(`SELECT id, schedule, profile_id, status, customers, items, failed, error, started_at, completed_at
+		FROM schedule_runs WHERE schedule = ? ORDER BY started_at DESC LIMIT ?`, schedule, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runs := []*ScheduleRun{}
+	for rows.Next() {
+		run := &ScheduleRun{}
+		var startedAt, completedAt int64
+		if err := rows.Scan(&run.ID, &run.Schedule, &run.ProfileID, &run.Status, &run.Customers, &run.Items, &run.Failed, &run.Error, &startedAt, &completedAt); err != nil {
+			return nil, err
+		}
+		run.StartedAt = time.Unix(startedAt, 0)
+		if completedAt != 0 {
+			run.CompletedAt = time.Unix(completedAt, 0)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+//Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,311 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paypermint/appkit"
+)
+
+//SAP connection schemes
+const (
+	SAPSchemeHTTP  = "http"
+	SAPSchemeHTTPS = "https"
+)
+
+// defaultSAPTimeout is the timeout of a SAP request when a tenant does not set one
+const defaultSAPTimeout = 5 * time.Minute
+
+//ErrUnknownTenant is returned when no SAP system is configured for a profile
+var ErrUnknownTenant = errors.New("no SAP system is configured for the profile")
+
+//ErrInvalidTenantCredentials is returned when the secret key sent with an access id bound to a tenant does not match
+var ErrInvalidTenantCredentials = errors.New("invalid credentials for the SAP tenant")
+
+var tenantRegistry *TenantRegistry
+
+//SetTenantRegistry sets the registry the SAP system of a profile is looked up in
+func SetTenantRegistry(registry *TenantRegistry) {
+	tenantRegistry = registry
+}
+
+//SAPEndpoints names the PI RESTAdapter endpoints of a SAP system
+type SAPEndpoints struct {
+	OpenItems           string `json:"open_items,omitempty"`
+	PaymentConfirmation string `json:"payment_confirmation,omitempty"`
+}
+
+//TenantAccessKey binds a payabbhi access id to a profile, the Basic auth requests made with it act for the profile
+type TenantAccessKey struct {
+	AccessID string `json:"access_id"`
+	// SecretKeySHA256 is the hex SHA-256 of the secret key of the access id
+	SecretKeySHA256 string `json:"secret_key_sha256"`
+}
+
+//SAPProfile is the SAP system of a merchant
+type SAPProfile struct {
+	ProfileID string `json:"profile_id"`
+	// BaseURL is the host, port and path of the PI RESTAdapter, without scheme
+	BaseURL   string       `json:"base_url"`
+	Scheme    string       `json:"scheme,omitempty"`
+	CredsPath string       `json:"creds_path"`
+	Endpoints SAPEndpoints `json:"endpoints"`
+	// Timeout is a duration such as 90s bounding every attempt of a request
+	Timeout string `json:"timeout,omitempty"`
+	// WebhookSecretEnv names the environment variable with the secret payabbhi signs the webhooks of the profile
+	// with, the webhooks of a profile without one are rejected
+	WebhookSecretEnv string `json:"webhook_secret_env,omitempty"`
+	// AccessKeys are the payabbhi access ids authenticating Basic auth requests for the profile
+	AccessKeys []TenantAccessKey `json:"access_keys,omitempty"`
+
+	timeout       time.Duration
+	webhookSecret string
+	// upstream names the circuit breaker of the SAP system, so that one merchant's unavailable ERP does not fail
+	// the requests of the others
+	upstream string
+}
+
+// baseURL returns the URL the PI RESTAdapter endpoints are relative to
+func (p *SAPProfile) baseURL() string {
+	return fmt.Sprintf("%s://%s", p.Scheme, strings.TrimSuffix(p.BaseURL, "/"))
+}
+
+func (p *SAPProfile) validate() error {
+	if p.ProfileID == EmptyString || p.BaseURL == EmptyString || p.CredsPath == EmptyString {
+		return errors.New("SAP tenant needs a profile_id, a base_url and a creds_path")
+	}
+	switch p.Scheme {
+	case EmptyString:
+		p.Scheme = SAPSchemeHTTP
+	case SAPSchemeHTTP, SAPSchemeHTTPS:
+	default:
+		return fmt.Errorf("SAP tenant %s: unknown scheme %s", p.ProfileID, p.Scheme)
+	}
+	if strings.Contains(p.BaseURL, "://") {
+		return fmt.Errorf("SAP tenant %s: base_url is given without scheme", p.ProfileID)
+	}
+	p.timeout = defaultSAPTimeout
+	if p.Timeout != EmptyString {
+		timeout, err := time.ParseDuration(p.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("SAP tenant %s: invalid timeout %s", p.ProfileID, p.Timeout)
+		}
+		p.timeout = timeout
+	}
+	if p.WebhookSecretEnv != EmptyString {
+		if p.webhookSecret = os.Getenv(p.WebhookSecretEnv); p.webhookSecret == EmptyString {
+			return fmt.Errorf("SAP tenant %s: environment variable %s is not set", p.ProfileID, p.WebhookSecretEnv)
+		}
+	}
+	for _, key := range p.AccessKeys {
+		if key.AccessID == EmptyString {
+			return fmt.Errorf("SAP tenant %s: access key needs an access_id", p.ProfileID)
+		}
+		if sum, err := hex.DecodeString(key.SecretKeySHA256); err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("SAP tenant %s: invalid secret_key_sha256 of access id %s", p.ProfileID, key.AccessID)
+		}
+	}
+	p.Endpoints.setDefaults()
+	p.upstream = UpstreamSAP + ":" + p.ProfileID
+	return nil
+}
+
+func (e *SAPEndpoints) setDefaults() {
+	if e.OpenItems == EmptyString {
+		e.OpenItems = sapOpenItemsEndpoint
+	}
+	if e.PaymentConfirmation == EmptyString {
+		e.PaymentConfirmation = sapPaymentConfirmationEndpoint
+	}
+}
+
+// defaultSAPProfile is the SAP system set with SetSapURL, serving every profile when there is no tenant registry
+func defaultSAPProfile() *SAPProfile {
+	if GetSapURL() == EmptyString {
+		return nil
+	}
+	profile := &SAPProfile{
+		BaseURL:   GetSapURL(),
+		Scheme:    SAPSchemeHTTP,
+		CredsPath: GetSapUserCredsPath(),
+		timeout:   defaultSAPTimeout,
+		upstream:  UpstreamSAP,
+	}
+	profile.Endpoints.setDefaults()
+	return profile
+}
+
+//GetSAPProfile returns the SAP system of a profile. Once a tenant registry is set only the profiles with a tenant
+//entry are served, without one every profile is served by the SAP system set with SetSapURL, if any
+func GetSAPProfile(profileID string) (*SAPProfile, error) {
+	if tenantRegistry != nil {
+		if profile, ok := tenantRegistry.profile(profileID); ok {
+			return profile, nil
+		}
+		return nil, ErrUnknownTenant
+	}
+	if profile := defaultSAPProfile(); profile != nil {
+		return profile, nil
+	}
+	return nil, ErrUnknownTenant
+}
+
+//IsTenantRegistryEnabled returns true if the SAP systems of the profiles are looked up in a tenant registry
+func IsTenantRegistryEnabled() bool {
+	return tenantRegistry != nil
+}
+
+//ProfileIDForAccessKey returns the profile a payabbhi access id is bound to in the tenant registry, false if it is
+//not bound. ErrInvalidTenantCredentials is returned when the secret key is not the one of the binding
+func ProfileIDForAccessKey(accessID, secretKey string) (string, bool, error) {
+	if tenantRegistry == nil {
+		return EmptyString, false, nil
+	}
+	binding, ok := tenantRegistry.accessKey(accessID)
+	if !ok {
+		return EmptyString, false, nil
+	}
+	sum := sha256.Sum256([]byte(secretKey))
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(binding.secretKeySHA256)) != 1 {
+		return EmptyString, false, ErrInvalidTenantCredentials
+	}
+	return binding.profileID, true, nil
+}
+
+// accessKeyBinding is the profile an access id is bound to, along with the lower case hex SHA-256 of its secret key
+type accessKeyBinding struct {
+	profileID       string
+	secretKeySHA256 string
+}
+
+//TenantRegistry holds the SAP system of every merchant, read from a JSON array of SAP profiles
+type TenantRegistry struct {
+	path string
+
+	mu         sync.RWMutex
+	profiles   map[string]*SAPProfile
+	accessKeys map[string]accessKeyBinding
+	modTime    time.Time
+}
+
+//LoadTenantRegistry reads the SAP profiles of the file at path
+func LoadTenantRegistry(path string) (*TenantRegistry, error) {
+	registry := &TenantRegistry{path: path}
+	if err := registry.Reload(); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+//Reload reads the file of the registry again. The profiles in use are kept when the file is invalid
+func (r *TenantRegistry) Reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	var tenants []*SAPProfile
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return err
+	}
+	profiles := map[string]*SAPProfile{}
+	accessKeys := map[string]accessKeyBinding{}
+	for _, tenant := range tenants {
+		if err := tenant.validate(); err != nil {
+			return err
+		}
+		if _, dup := profiles[tenant.ProfileID]; dup {
+			return fmt.Errorf("SAP tenant %s is defined twice", tenant.ProfileID)
+		}
+		profiles[tenant.ProfileID] = tenant
+		for _, key := range tenant.AccessKeys {
+			if bound, dup := accessKeys[key.AccessID]; dup {
+				return fmt.Errorf("access id %s is bound to SAP tenants %s and %s", key.AccessID, bound.profileID, tenant.ProfileID)
+			}
+			accessKeys[key.AccessID] = accessKeyBinding{
+				profileID:       tenant.ProfileID,
+				secretKeySHA256: strings.ToLower(key.SecretKeySHA256),
+			}
+		}
+		// the breaker state of every tenant is reported before it is first called
+		GetCircuitBreaker(tenant.upstream)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profiles = profiles
+	r.accessKeys = accessKeys
+	r.modTime = info.ModTime()
+	return nil
+}
+
+//Watch reloads the registry whenever its file has been modified, checking every interval until the returned
+//function is called
+func (r *TenantRegistry) Watch(interval time.Duration, logger appkit.AppLogger) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		// an invalid file is reported once, not on every tick until it is fixed
+		var failedModTime time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				info, err := os.Stat(r.path)
+				if err != nil || info.ModTime().Equal(r.loadedModTime()) || info.ModTime().Equal(failedModTime) {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					failedModTime = info.ModTime()
+					logger.Error("unable to reload SAP tenants", "path", r.path, "error_message", err.Error())
+					continue
+				}
+				logger.Info("Reloaded SAP tenants", "path", r.path, "tenants", r.count())
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+func (r *TenantRegistry) loadedModTime() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.modTime
+}
+
+func (r *TenantRegistry) profile(profileID string) (*SAPProfile, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	profile, ok := r.profiles[profileID]
+	return profile, ok
+}
+
+func (r *TenantRegistry) accessKey(accessID string) (accessKeyBinding, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	binding, ok := r.accessKeys[accessID]
+	return binding, ok
+}
+
+func (r *TenantRegistry) count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.profiles)
+}
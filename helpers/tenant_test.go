@@ -0,0 +1,185 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func secretKeySHA256(secretKey string) string {
+	sum := sha256.Sum256([]byte(secretKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeTenants(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadTestTenantRegistry loads the tenants of content and sets them as tenant registry for the test
+func loadTestTenantRegistry(t *testing.T, content string) (*TenantRegistry, string) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	writeTenants(t, path, content)
+	registry, err := LoadTenantRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadTenantRegistry() error = %v", err)
+	}
+	previous := tenantRegistry
+	SetTenantRegistry(registry)
+	t.Cleanup(func() { SetTenantRegistry(previous) })
+	return registry, path
+}
+
+func TestLoadTenantRegistry(t *testing.T) {
+	t.Setenv("TENANT_TEST_WEBHOOK_SECRET", "whsec")
+	hash := secretKeySHA256("secret")
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			content: `[{"profile_id":"p1","base_url":"sap.example.com:50000","creds_path":"sap/p1","webhook_secret_env":"TENANT_TEST_WEBHOOK_SECRET","access_keys":[{"access_id":"a1","secret_key_sha256":"` + hash + `"}]}]`,
+		},
+		{name: "not an array", content: `{"profile_id":"p1"}`, wantErr: "cannot unmarshal"},
+		{name: "missing creds path", content: `[{"profile_id":"p1","base_url":"sap.example.com"}]`, wantErr: "needs a profile_id"},
+		{name: "unknown scheme", content: `[{"profile_id":"p1","base_url":"sap.example.com","creds_path":"c","scheme":"ftp"}]`, wantErr: "unknown scheme ftp"},
+		{name: "base url with scheme", content: `[{"profile_id":"p1","base_url":"https://sap.example.com","creds_path":"c"}]`, wantErr: "without scheme"},
+		{name: "invalid timeout", content: `[{"profile_id":"p1","base_url":"sap.example.com","creds_path":"c","timeout":"-1s"}]`, wantErr: "invalid timeout"},
+		{
+			name:    "webhook secret not set",
+			content: `[{"profile_id":"p1","base_url":"sap.example.com","creds_path":"c","webhook_secret_env":"TENANT_TEST_UNSET"}]`,
+			wantErr: "TENANT_TEST_UNSET is not set",
+		},
+		{
+			name:    "secret key not hashed",
+			content: `[{"profile_id":"p1","base_url":"sap.example.com","creds_path":"c","access_keys":[{"access_id":"a1","secret_key_sha256":"secret"}]}]`,
+			wantErr: "invalid secret_key_sha256",
+		},
+		{
+			name: "defined twice",
+			content: `[{"profile_id":"p1","base_url":"sap.example.com","creds_path":"c"},
+				{"profile_id":"p1","base_url":"sap2.example.com","creds_path":"c"}]`,
+			wantErr: "defined twice",
+		},
+		{
+			name: "access id bound twice",
+			content: `[{"profile_id":"p1","base_url":"sap.example.com","creds_path":"c","access_keys":[{"access_id":"a1","secret_key_sha256":"` + hash + `"}]},
+				{"profile_id":"p2","base_url":"sap2.example.com","creds_path":"c","access_keys":[{"access_id":"a1","secret_key_sha256":"` + hash + `"}]}]`,
+			wantErr: "bound to SAP tenants p1 and p2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tenants.json")
+			writeTenants(t, path, tt.content)
+			_, err := LoadTenantRegistry(path)
+			if tt.wantErr != EmptyString {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadTenantRegistry() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadTenantRegistry() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestTenantRegistryReload(t *testing.T) {
+	registry, path := loadTestTenantRegistry(t, `[{"profile_id":"p1","base_url":"sap.example.com","creds_path":"c"}]`)
+
+	writeTenants(t, path, `[{"profile_id":"p1","base_url":"sap.example.com"}]`)
+	if err := registry.Reload(); err == nil {
+		t.Fatal("Reload() of an invalid file succeeded")
+	}
+	if _, err := GetSAPProfile("p1"); err != nil {
+		t.Fatalf("GetSAPProfile() after an invalid reload error = %v, want the profile in use", err)
+	}
+
+	writeTenants(t, path, `[{"profile_id":"p2","base_url":"sap2.example.com","creds_path":"c"}]`)
+	if err := registry.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, err := GetSAPProfile("p2"); err != nil {
+		t.Fatalf("GetSAPProfile() of a new profile error = %v", err)
+	}
+	if _, err := GetSAPProfile("p1"); err != ErrUnknownTenant {
+		t.Fatalf("GetSAPProfile() of a removed profile error = %v, want %v", err, ErrUnknownTenant)
+	}
+}
+
+func TestProfileIDForAccessKey(t *testing.T) {
+	// hashes are given in any case
+	loadTestTenantRegistry(t, `[{"profile_id":"p1","base_url":"sap.example.com","creds_path":"c",
+		"access_keys":[{"access_id":"a1","secret_key_sha256":"`+strings.ToUpper(secretKeySHA256("secret"))+`"}]}]`)
+
+	tests := []struct {
+		name        string
+		accessID    string
+		secretKey   string
+		wantProfile string
+		wantBound   bool
+		wantErr     error
+	}{
+		{name: "bound", accessID: "a1", secretKey: "secret", wantProfile: "p1", wantBound: true},
+		{name: "wrong secret key", accessID: "a1", secretKey: "Secret", wantErr: ErrInvalidTenantCredentials},
+		{name: "hash given as secret key", accessID: "a1", secretKey: secretKeySHA256("secret"), wantErr: ErrInvalidTenantCredentials},
+		{name: "not bound", accessID: "a2", secretKey: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profileID, bound, err := ProfileIDForAccessKey(tt.accessID, tt.secretKey)
+			if profileID != tt.wantProfile || bound != tt.wantBound || err != tt.wantErr {
+				t.Fatalf("ProfileIDForAccessKey() = %q, %v, %v, want %q, %v, %v", profileID, bound, err, tt.wantProfile, tt.wantBound, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetSAPProfile(t *testing.T) {
+	previousURL, previousCredsPath := GetSapURL(), GetSapUserCredsPath()
+	t.Cleanup(func() {
+		SetSapURL(previousURL)
+		SetSapUserCredsPath(previousCredsPath)
+	})
+	previous := tenantRegistry
+	SetTenantRegistry(nil)
+	t.Cleanup(func() { SetTenantRegistry(previous) })
+
+	SetSapURL(EmptyString)
+	if _, err := GetSAPProfile("p1"); err != ErrUnknownTenant {
+		t.Fatalf("GetSAPProfile() without SAP system error = %v, want %v", err, ErrUnknownTenant)
+	}
+
+	SetSapURL("sap.example.com")
+	SetSapUserCredsPath("sap/creds")
+	profile, err := GetSAPProfile("p1")
+	if err != nil {
+		t.Fatalf("GetSAPProfile() of the global SAP system error = %v", err)
+	}
+	if profile.baseURL() != "http://sap.example.com" || profile.CredsPath != "sap/creds" || profile.upstream != UpstreamSAP {
+		t.Fatalf("GetSAPProfile() = %+v, want the global SAP system", profile)
+	}
+
+	loadTestTenantRegistry(t, `[{"profile_id":"p1","base_url":"sap1.example.com/","scheme":"https","creds_path":"sap/p1","timeout":"90s"}]`)
+	profile, err = GetSAPProfile("p1")
+	if err != nil {
+		t.Fatalf("GetSAPProfile() of a tenant error = %v", err)
+	}
+	if profile.baseURL() != "https://sap1.example.com" || profile.CredsPath != "sap/p1" || profile.timeout != 90*time.Second ||
+		profile.upstream != UpstreamSAP+":p1" || profile.Endpoints.OpenItems == EmptyString {
+		t.Fatalf("GetSAPProfile() = %+v, want the SAP system of the tenant", profile)
+	}
+	if _, err := GetSAPProfile("p2"); err != ErrUnknownTenant {
+		t.Fatalf("GetSAPProfile() of a profile without tenant error = %v, want %v", err, ErrUnknownTenant)
+	}
+}
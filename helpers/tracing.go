@@ -0,0 +1,113 @@
+package helpers
+
+import (
+	"context"
+	"net/http"
+	"path"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/paypermint/bridge-app-svc"
+
+// sapMessageIDKey is the response header, or else the response field, the SAP PI RESTAdapter returns the id of
+// the message in the PI message monitor with
+const sapMessageIDKey = "MessageId"
+
+//Span attributes
+const (
+	AttributeBridgeTraceID = attribute.Key("bridge.trace_id")
+	attributeUpstream      = attribute.Key("bridge.upstream")
+	attributeOperation     = attribute.Key("bridge.operation")
+	attributeSAPMessageID  = attribute.Key("sap.message_id")
+	attributeStatusCode    = attribute.Key("http.response.status_code")
+)
+
+//InitTracing propagates W3C trace context on inbound and outbound requests. Spans are exported over OTLP/HTTP to
+//endpointURL, without one they are not recorded and only the incoming trace context is passed on.
+//The returned function flushes the spans not exported yet
+func InitTracing(serviceName, endpointURL string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if endpointURL == EmptyString {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpointURL))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+//Tracer returns the tracer of the service
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+//EndSpan records the status code of a served or outbound request on span and ends it, 5xx responses and errors
+//mark the span as failed
+func EndSpan(span trace.Span, statusCode int, err error) {
+	if statusCode > 0 {
+		span.SetAttributes(attributeStatusCode.Int(statusCode))
+	}
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case statusCode >= http.StatusInternalServerError:
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+	span.End()
+}
+
+// detachTrace returns a context carrying only the trace of ctx, for work outliving the request it was started by
+func detachTrace(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
+
+// startSpan starts the client span of the outbound call as a child of the request context, the span covers all
+// attempts of the call
+func (c *Client) startSpan(req *http.Request) (*http.Request, trace.Span) {
+	operation := path.Base(req.URL.Path)
+	ctx, span := Tracer().Start(req.Context(), c.upstream+" "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attributeUpstream.String(c.upstream),
+			attributeOperation.String(operation),
+			attribute.String("http.request.method", req.Method),
+		))
+	return req.WithContext(ctx), span
+}
+
+// injectTrace sets the traceparent header of an outbound request
+func injectTrace(req *http.Request) {
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+}
+
+// recordSAPMessageID records the PI message id of a SAP response on span, read from the response header or else
+// from the decoded response
+func recordSAPMessageID(span trace.Span, header http.Header, data interface{}) {
+	messageID := header.Get(sapMessageIDKey)
+	if messageID == EmptyString {
+		if fields, ok := data.(map[string]interface{}); ok {
+			messageID, _ = GetStringInterfaceParam(fields, sapMessageIDKey, true)
+		}
+	}
+	if messageID != EmptyString {
+		span.SetAttributes(attributeSAPMessageID.String(messageID))
+	}
+}
@@ -0,0 +1,198 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paypermint/bridge-app-svc/models"
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+//WebhookEventPaymentCaptured is the payabbhi webhook event type whose payment is posted to the ERP. Events such as
+//invoice.paid carry the invoice without its payments and are acknowledged without posting
+const WebhookEventPaymentCaptured = "payment.captured"
+
+const webhookEventObject = "webhook_event"
+
+//Webhook event statuses
+const (
+	WebhookEventStatusPosted  = "posted"
+	WebhookEventStatusIgnored = "ignored"
+)
+
+//ErrInvalidWebhookSignature is returned when the signature of a webhook does not match its payload
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+var (
+	webhookSecret    string
+	webhookTolerance = 5 * time.Minute
+)
+
+//SetWebhookConfig sets the secret payabbhi webhooks are signed with and how old a signed webhook may be
+func SetWebhookConfig(secret string, tolerance time.Duration) {
+	webhookSecret = secret
+	webhookTolerance = tolerance
+}
+
+//WebhookEvent represents a payabbhi webhook event
+type WebhookEvent struct {
+	ID        string            `json:"id"`
+	Object    string            `json:"object"`
+	Type      string            `json:"type"`
+	Data      *WebhookEventData `json:"data"`
+	CreatedAt int64             `json:"created_at"`
+}
+
+//WebhookEventData holds the objects a webhook event is about
+type WebhookEventData struct {
+	Payment *WebhookPayment `json:"payment,omitempty"`
+	Invoice *WebhookInvoice `json:"invoice,omitempty"`
+}
+
+//WebhookPayment represents the payment of a webhook event
+type WebhookPayment struct {
+	ID        string `json:"id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Status    string `json:"status"`
+	InvoiceID string `json:"invoice_id,omitempty"`
+}
+
+//WebhookInvoice represents the invoice of a webhook event
+type WebhookInvoice struct {
+	ID                string `json:"id"`
+	MerchantInvoiceID string `json:"merchant_invoice_id"`
+	CustomerID        string `json:"customer_id"`
+	Label             string `json:"label"`
+	Description       string `json:"description"`
+	AmountPaid        int64  `json:"amount_paid"`
+	Currency          string `json:"currency"`
+}
+
+// webhookSecretFor returns the secret the webhooks of a profile are signed with. The webhooks without a profile are
+// signed with the secret set with SetWebhookConfig, those of a tenant with the secret of its SAP profile
+func webhookSecretFor(profileID string) string {
+	if profileID == EmptyString {
+		return webhookSecret
+	}
+	if tenantRegistry == nil {
+		return EmptyString
+	}
+	profile, ok := tenantRegistry.profile(profileID)
+	if !ok {
+		return EmptyString
+	}
+	return profile.webhookSecret
+}
+
+//VerifyWebhookSignature checks the signature header of a payabbhi webhook of a profile, formatted as
+//t=<unix time>,v1=<hex hmac>. The HMAC-SHA256 is computed with the webhook secret of the profile over the payload
+//followed by & and the timestamp
+func VerifyWebhookSignature(profileID string, payload []byte, signature string) error {
+	secret := webhookSecretFor(profileID)
+	if secret == EmptyString {
+		return ErrInvalidWebhookSignature
+	}
+	var timestamp, expected string
+	for _, part := range strings.Split(signature, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			expected = kv[1]
+		}
+	}
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || expected == EmptyString {
+		return ErrInvalidWebhookSignature
+	}
+	if age := time.Since(time.Unix(signedAt, 0)); age > webhookTolerance || age < -webhookTolerance {
+		// an old signature is a replayed webhook
+		return ErrInvalidWebhookSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	mac.Write([]byte("&" + timestamp))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(strings.ToLower(expected))) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+//ParseWebhookEvent decodes the payload of a payabbhi webhook
+func ParseWebhookEvent(payload []byte) (*WebhookEvent, error) {
+	event := &WebhookEvent{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	if event.Type == EmptyString {
+		return nil, errors.New(util.MissingMandatoryField)
+	}
+	return event, nil
+}
+
+//IsPaymentWebhookEvent returns true for the events whose payments are posted to the ERP
+func IsPaymentWebhookEvent(eventType string) bool {
+	return eventType == WebhookEventPaymentCaptured
+}
+
+//WebhookPaymentRecords maps a payment webhook event to the payment confirmation records of the ERP. Only payments of
+//invoices synced from the ERP are posted back, the records are nil for any other payment.
+//The payment id is the transaction_ref, so a payment delivered again is posted once
+func WebhookPaymentRecords(profileID string, event *WebhookEvent) ([]*SapRecord, error) {
+	if event.Data == nil || event.Data.Invoice == nil || event.Data.Invoice.MerchantInvoiceID == EmptyString ||
+		event.Data.Payment == nil || event.Data.Payment.ID == EmptyString {
+		return nil, nil
+	}
+	invoice, payment := event.Data.Invoice, event.Data.Payment
+	synced, err := getSyncedInvoice(profileID, invoice.MerchantInvoiceID)
+	if err != nil || synced == nil {
+		return nil, err
+	}
+
+	transactionRef, amount, currency := payment.ID, payment.Amount, payment.Currency
+	if amount <= 0 {
+		return nil, nil
+	}
+	if currency == EmptyString {
+		currency = util.CurrencyINR
+	}
+	record := &SapRecord{
+		CustomerNumber: synced.MerchantCustomerID,
+		CompanyCode:    invoice.Label,
+		Description:    invoice.Description,
+		Item:           invoice.MerchantInvoiceID,
+		PaymentAmount:  NewMoneyFromMinor(amount, currency),
+		TransactionRef: transactionRef,
+	}
+	if err := setLocalAmount(record); err != nil {
+		return nil, fmt.Errorf("payment %s in %s: %v", transactionRef, currency, err)
+	}
+	return []*SapRecord{record}, nil
+}
+
+//NewWebhookEventResult returns the API structure for what was done with event
+func NewWebhookEventResult(event *WebhookEvent, status string, response *SAPSuccessResponse) *models.WebhookEventResult {
+	result := &models.WebhookEventResult{
+		Object: webhookEventObject,
+		ID:     event.ID,
+		Type:   event.Type,
+		Status: status,
+	}
+	if response != nil {
+		result.Response = response
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setWebhookConfig(t *testing.T, secret string, tolerance time.Duration) {
+	previousSecret, previousTolerance := webhookSecret, webhookTolerance
+	SetWebhookConfig(secret, tolerance)
+	t.Cleanup(func() { SetWebhookConfig(previousSecret, previousTolerance) })
+}
+
+// signWebhook returns the signature header of payload signed with secret at signedAt
+func signWebhook(secret string, payload []byte, signedAt time.Time) string {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	mac.Write([]byte("&" + timestamp))
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	setWebhookConfig(t, "global_secret", 5*time.Minute)
+	t.Setenv("WEBHOOK_TEST_SECRET", "tenant_secret")
+	loadTestTenantRegistry(t, `[{"profile_id":"p1","base_url":"sap.example.com","creds_path":"c","webhook_secret_env":"WEBHOOK_TEST_SECRET"},
+		{"profile_id":"p2","base_url":"sap2.example.com","creds_path":"c"}]`)
+
+	payload := []byte(`{"id":"evt_1","type":"payment.captured"}`)
+	now := time.Now()
+	signature := signWebhook("global_secret", payload, now)
+	v1 := signature[strings.Index(signature, "v1="):]
+	tests := []struct {
+		name      string
+		profileID string
+		signature string
+		wantErr   bool
+	}{
+		{name: "global secret", signature: signWebhook("global_secret", payload, now)},
+		{name: "tenant secret", profileID: "p1", signature: signWebhook("tenant_secret", payload, now)},
+		{name: "within tolerance", signature: signWebhook("global_secret", payload, now.Add(-4*time.Minute))},
+		{name: "other secret", signature: signWebhook("other_secret", payload, now), wantErr: true},
+		{name: "global secret for a tenant", profileID: "p1", signature: signWebhook("global_secret", payload, now), wantErr: true},
+		{name: "tenant without secret", profileID: "p2", signature: signWebhook(EmptyString, payload, now), wantErr: true},
+		{name: "unknown tenant", profileID: "p3", signature: signWebhook("global_secret", payload, now), wantErr: true},
+		{name: "expired", signature: signWebhook("global_secret", payload, now.Add(-6*time.Minute)), wantErr: true},
+		{name: "from the future", signature: signWebhook("global_secret", payload, now.Add(6*time.Minute)), wantErr: true},
+		{name: "other payload", signature: signWebhook("global_secret", []byte(`{"id":"evt_2"}`), now), wantErr: true},
+		{name: "timestamp changed", signature: "t=" + strconv.FormatInt(now.Unix()+1, 10) + "," + v1, wantErr: true},
+		{name: "without timestamp", signature: v1, wantErr: true},
+		{name: "empty", signature: EmptyString, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(tt.profileID, payload, tt.signature)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyWebhookSignature(%q) error = %v, want error %v", tt.signature, err, tt.wantErr)
+			}
+			if err != nil && err != ErrInvalidWebhookSignature {
+				t.Fatalf("VerifyWebhookSignature() error = %v, want %v", err, ErrInvalidWebhookSignature)
+			}
+		})
+	}
+}
+
+func TestVerifyWebhookSignatureWithoutSecret(t *testing.T) {
+	setWebhookConfig(t, EmptyString, 5*time.Minute)
+	payload := []byte(`{"id":"evt_1"}`)
+	if err := VerifyWebhookSignature(EmptyString, payload, signWebhook(EmptyString, payload, time.Now())); err != ErrInvalidWebhookSignature {
+		t.Fatalf("VerifyWebhookSignature() without secret error = %v, want %v", err, ErrInvalidWebhookSignature)
+	}
+}
+
+func TestIsPaymentWebhookEvent(t *testing.T) {
+	for eventType, want := range map[string]bool{"payment.captured": true, "invoice.paid": false, "payment.failed": false} {
+		if got := IsPaymentWebhookEvent(eventType); got != want {
+			t.Fatalf("IsPaymentWebhookEvent(%s) = %v, want %v", eventType, got, want)
+		}
+	}
+}
+
+func TestWebhookPaymentRecords(t *testing.T) {
+	SetStore(NewMemoryStore())
+	if err := GetStore().SaveInvoice(&SyncedInvoice{
+		ProfileID:          "p1",
+		Item:               "INV-1",
+		MerchantInvoiceID:  "INV-1",
+		InvoiceID:          "invt_1",
+		MerchantCustomerID: "C1",
+		Payload:            "{}",
+		SyncedAt:           time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	event := func(invoiceID string, payment *WebhookPayment) *WebhookEvent {
+		return &WebhookEvent{ID: "evt_1", Type: WebhookEventPaymentCaptured, Data: &WebhookEventData{
+			Payment: payment,
+			Invoice: &WebhookInvoice{ID: "invt_1", MerchantInvoiceID: invoiceID, Label: "1000", Description: "May rent"},
+		}}
+	}
+	records, err := WebhookPaymentRecords("p1", event("INV-1", &WebhookPayment{ID: "pay_1", Amount: 123457, Currency: "INR"}))
+	if err != nil {
+		t.Fatalf("WebhookPaymentRecords() error = %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("WebhookPaymentRecords() = %d records, want 1", len(records))
+	}
+	record := records[0]
+	if record.TransactionRef != "pay_1" || record.CustomerNumber != "C1" || record.CompanyCode != "1000" || record.Item != "INV-1" ||
+		record.PaymentAmount.String() != "1234.57" {
+		t.Fatalf("WebhookPaymentRecords() = %+v, want the payment of INV-1", record)
+	}
+
+	for name, ignored := range map[string]*WebhookEvent{
+		"invoice not synced": event("INV-2", &WebhookPayment{ID: "pay_1", Amount: 100}),
+		"without payment":    event("INV-1", nil),
+		"without payment id": event("INV-1", &WebhookPayment{Amount: 100}),
+		"without amount":     event("INV-1", &WebhookPayment{ID: "pay_1"}),
+		"without data":       {ID: "evt_1", Type: WebhookEventPaymentCaptured},
+	} {
+		records, err := WebhookPaymentRecords("p1", ignored)
+		if err != nil || records != nil {
+			t.Fatalf("WebhookPaymentRecords() of an event %s = %v, %v, want no records", name, records, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package interceptors
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/helpers"
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+// publicPathPrefixes are served without the profile of a caller, payabbhi webhooks are authenticated by their signature
+var publicPathPrefixes = []string{"/apilist", "/bridgeapp/v1/webhooks/payabbhi"}
+
+// AuthInterceptor establishes the profile of a request from the identity of its caller before it reaches a handler:
+// the profile of a verified bearer token, or the profile a Basic auth access id is bound to in the SAP tenants. The
+// profile takes the place of the Profile-Id header. A request whose profile can not be established, or which sends
+// another Profile-Id, is answered with 401 without calling an upstream. Until SAP tenants or bearer token
+// verification are configured the deployment serves a single merchant and requests are passed on as is
+type AuthInterceptor struct {
+	appCtx *appkit.AppContext
+}
+
+// NewAuthInterceptor returns a new instance of AuthInterceptor
+func NewAuthInterceptor(appctx *appkit.AppContext) *AuthInterceptor {
+	return &AuthInterceptor{appCtx: appctx}
+}
+
+func (rec *AuthInterceptor) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !helpers.IsJWTVerificationEnabled() && !helpers.IsTenantRegistryEnabled() || isPublicPath(r.URL.Path) {
+		next(rw, r)
+		return
+	}
+	ctxlogger := appkit.GetContextLogger(rec.appCtx.Logger, r)
+
+	ctx := r.Context()
+	profileID, authenticated := helpers.EmptyString, false
+	if token, ok := helpers.BearerTokenFromRequest(r); ok && helpers.IsJWTVerificationEnabled() {
+		claims, err := helpers.VerifyBearerToken(token)
+		if err != nil {
+			ctxlogger.Warn("rejected bearer token", "error_message", err.Error())
+			util.RenderErrorJSON(rec.appCtx, rw, http.StatusUnauthorized, util.InvalidBearerTokenMsg, util.KeyAuthorization)
+			return
+		}
+		profileID, authenticated = claims.ProfileID, true
+		// the environment of the token takes the place of the header sent
+		if claims.Environment != helpers.EmptyString {
+			r.Header.Set(util.KeyEnvironment, claims.Environment)
+		}
+		ctx = helpers.WithTokenClaims(ctx, claims)
+	} else if accessID, secretKey, ok := r.BasicAuth(); ok {
+		var err error
+		if profileID, authenticated, err = helpers.ProfileIDForAccessKey(accessID, secretKey); err != nil {
+			ctxlogger.Warn("rejected access key", "access_id", accessID, "error_message", err.Error())
+			util.RenderErrorJSON(rec.appCtx, rw, http.StatusUnauthorized, util.InvalidCredentialsMsg, util.KeyAuthorization)
+			return
+		}
+	}
+
+	if !authenticated || profileID == helpers.EmptyString {
+		ctxlogger.Warn("rejected request without profile credentials")
+		util.RenderErrorJSON(rec.appCtx, rw, http.StatusUnauthorized, util.MissingProfileCredentialsMsg, util.KeyAuthorization)
+		return
+	}
+	// a caller can not act for another merchant by changing the Profile-Id
+	if sent := util.ProfileIDFromHTTPRequest(r); sent != helpers.EmptyString && sent != profileID {
+		ctxlogger.Warn("rejected unauthenticated profile", "profile_id", sent)
+		util.RenderErrorJSON(rec.appCtx, rw, http.StatusUnauthorized, util.ProfileNotAuthenticatedMsg, util.KeyProfileID)
+		return
+	}
+	r.Header.Set(util.KeyProfileID, profileID)
+	next(rw, r.WithContext(ctx))
+}
+
+func isPublicPath(path string) bool {
+	for _, prefix := range publicPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
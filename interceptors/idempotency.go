@@ -0,0 +1,238 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/helpers"
+	"github.com/paypermint/bridge-app-svc/util"
+	"github.com/urfave/negroni"
+)
+
+const (
+	// maxIdempotencyKeyLen bounds the Idempotency-Key header
+	maxIdempotencyKeyLen = 255
+	// bodyMemoryLimit is the size up to which a request body is kept in memory, larger bodies are spooled to a file
+	bodyMemoryLimit = 1 << 20
+	// bodyOverhead is allowed on top of the maximum upload size for the parts and boundaries of a multipart body
+	bodyOverhead = 1 << 20
+)
+
+// IdempotencyInterceptor replays the response of a mutating request which is retried with the same Idempotency-Key.
+// A key sent with a different request, or while its first request is still being handled, is answered with 409
+type IdempotencyInterceptor struct {
+	appCtx *appkit.AppContext
+	store  helpers.IdempotencyStore
+	// lockTTL bounds how long a key stays reserved by a request which never completes, such as one of a crashed
+	// instance
+	lockTTL time.Duration
+	ttl     time.Duration
+}
+
+// NewIdempotencyInterceptor returns a new instance of IdempotencyInterceptor reserving keys in store for lockTTL while
+// their request is handled and keeping the responses for ttl
+func NewIdempotencyInterceptor(appctx *appkit.AppContext, store helpers.IdempotencyStore, lockTTL, ttl time.Duration) *IdempotencyInterceptor {
+	return &IdempotencyInterceptor{appCtx: appctx, store: store, lockTTL: lockTTL, ttl: ttl}
+}
+
+func (rec *IdempotencyInterceptor) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	key := r.Header.Get(util.KeyIdempotencyKey)
+	if key == helpers.EmptyString || !isMutatingMethod(r.Method) {
+		next(rw, r)
+		return
+	}
+	ctxlogger := appkit.GetContextLogger(rec.appCtx.Logger, r)
+	if len(key) > maxIdempotencyKeyLen {
+		util.RenderErrorJSON(rec.appCtx, rw, http.StatusBadRequest, util.InvalidParameterMsg, util.KeyIdempotencyKey)
+		return
+	}
+
+	body, err := spoolBody(http.MaxBytesReader(rw, r.Body, helpers.GetMaxUploadSize()+bodyOverhead))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			util.RenderErrorJSON(rec.appCtx, rw, http.StatusRequestEntityTooLarge, util.UploadTooLargeMsg, helpers.EmptyString)
+			return
+		}
+		ctxlogger.Crit(err.Error())
+		util.RenderAPIErrorJSON(rec.appCtx, rw)
+		return
+	}
+	defer body.Close()
+	fingerprint, err := fingerprintRequest(r, body)
+	if err != nil {
+		util.RenderErrorJSON(rec.appCtx, rw, http.StatusBadRequest, util.InvalidParameterMsg, util.KeyContentType)
+		return
+	}
+	r.Body = body
+
+	// keys are scoped to the merchant and the endpoint
+	storeKey := strings.Join([]string{util.ProfileIDFromHTTPRequest(r), r.Method, r.URL.Path, key}, ":")
+	existing, err := rec.store.Reserve(r.Context(), storeKey, &helpers.IdempotentResponse{Fingerprint: fingerprint}, rec.lockTTL)
+	if err != nil {
+		ctxlogger.Crit("unable to reserve idempotency key", "error_message", err.Error())
+		util.RenderAPIErrorJSON(rec.appCtx, rw)
+		return
+	}
+	switch {
+	case existing == nil:
+	case existing.Fingerprint != fingerprint:
+		util.RenderErrorJSON(rec.appCtx, rw, http.StatusConflict, util.IdempotencyKeyReusedMsg, util.KeyIdempotencyKey)
+		return
+	case !existing.Completed:
+		util.RenderErrorJSON(rec.appCtx, rw, http.StatusConflict, util.IdempotencyKeyInProgressMsg, util.KeyIdempotencyKey)
+		return
+	default:
+		ctxlogger.Info("Replaying response", "idempotency_key", key, "status", existing.StatusCode)
+		replayResponse(rw, existing)
+		return
+	}
+
+	completed := false
+	defer func() {
+		// the key is released when the response is not kept, also when the handler panics
+		if !completed {
+			if err := rec.store.Release(context.Background(), storeKey); err != nil {
+				ctxlogger.Error("unable to release idempotency key", "error_message", err.Error())
+			}
+		}
+	}()
+	recorder := &recordingResponseWriter{ResponseWriter: negroni.NewResponseWriter(rw)}
+	next(recorder, r)
+
+	if !isReplayableStatus(recorder.Status()) {
+		return
+	}
+	if err := rec.store.Complete(context.Background(), storeKey, &helpers.IdempotentResponse{
+		Fingerprint: fingerprint,
+		Completed:   true,
+		StatusCode:  recorder.Status(),
+		Header:      recorder.Header().Clone(),
+		Body:        recorder.body.Bytes(),
+	}, rec.ttl); err != nil {
+		ctxlogger.Error("unable to save idempotent response", "error_message", err.Error())
+		return
+	}
+	completed = true
+}
+
+// recordingResponseWriter keeps a copy of the response body
+type recordingResponseWriter struct {
+	negroni.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func replayResponse(rw http.ResponseWriter, response *helpers.IdempotentResponse) {
+	for name, values := range response.Header {
+		rw.Header()[name] = values
+	}
+	rw.Header().Set(util.KeyIdempotentReplay, "true")
+	rw.WriteHeader(response.StatusCode)
+	rw.Write(response.Body)
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isReplayableStatus returns true if a response is kept for the key. Server errors, conflicts and rate limits are
+// not, a retry of such a request is handled again
+func isReplayableStatus(status int) bool {
+	return status < http.StatusInternalServerError && status != http.StatusConflict && status != http.StatusTooManyRequests
+}
+
+// fingerprintRequest hashes the method, path, query and body of a request. The parts of a multipart body are hashed
+// instead of its bytes, as a retried upload is sent with a new boundary
+func fingerprintRequest(r *http.Request, body io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+"\n"+r.URL.Path+"\n"+r.URL.RawQuery+"\n")
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get(util.KeyContentType))
+	if mediaType == "multipart/form-data" {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return helpers.EmptyString, err
+			}
+			io.WriteString(hash, part.FormName()+"\n"+part.FileName()+"\n")
+			if _, err := io.Copy(hash, part); err != nil {
+				return helpers.EmptyString, err
+			}
+		}
+	} else if _, err := io.Copy(hash, body); err != nil {
+		return helpers.EmptyString, err
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return helpers.EmptyString, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// spooledBody is a request body which can be read again
+type spooledBody struct {
+	io.ReadSeeker
+	close func() error
+}
+
+func (b *spooledBody) Close() error {
+	return b.close()
+}
+
+// spoolBody reads a request body into memory, or into a temporary file once it outgrows bodyMemoryLimit
+func spoolBody(r io.ReadCloser) (*spooledBody, error) {
+	defer r.Close()
+	head, err := io.ReadAll(io.LimitReader(r, bodyMemoryLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(head) <= bodyMemoryLimit {
+		return &spooledBody{ReadSeeker: bytes.NewReader(head), close: func() error { return nil }}, nil
+	}
+
+	file, err := os.CreateTemp(helpers.EmptyString, "body_")
+	if err != nil {
+		return nil, err
+	}
+	closeFile := func() error {
+		file.Close()
+		return os.Remove(file.Name())
+	}
+	if _, err := file.Write(head); err != nil {
+		closeFile()
+		return nil, err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		closeFile()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		closeFile()
+		return nil, err
+	}
+	return &spooledBody{ReadSeeker: file, close: closeFile}, nil
+}
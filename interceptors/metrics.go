@@ -0,0 +1,45 @@
+package interceptors
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/paypermint/bridge-app-svc/helpers"
+	"github.com/urfave/negroni"
+)
+
+// notFoundRoute labels the requests no route matched, so that unknown paths do not each get their own series
+const notFoundRoute = "not_found"
+
+// MetricsInterceptor is a middleware that counts the requests and observes their latency per route name
+type MetricsInterceptor struct {
+	router *mux.Router
+}
+
+// NewMetricsInterceptor returns a new instance of MetricsInterceptor labelling requests by the routes of router
+func NewMetricsInterceptor(router *mux.Router) *MetricsInterceptor {
+	return &MetricsInterceptor{router: router}
+}
+
+func (rec *MetricsInterceptor) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+	next(rw, r)
+	res := rw.(negroni.ResponseWriter)
+	helpers.ObserveHTTPRequest(routeName(rec.router, r), r.Method, res.Status(), time.Since(start))
+}
+
+// routeName returns the name of the route of router matching r, the path template for routes without a name
+func routeName(router *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(r, &match) || match.Route == nil {
+		return notFoundRoute
+	}
+	if name := match.Route.GetName(); name != "" {
+		return name
+	}
+	if template, err := match.Route.GetPathTemplate(); err == nil {
+		return template
+	}
+	return notFoundRoute
+}
@@ -0,0 +1,41 @@
+package interceptors
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/paypermint/appkit"
+	"github.com/paypermint/bridge-app-svc/helpers"
+	"github.com/urfave/negroni"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingInterceptor is a middleware that continues the W3C trace of the request in a server span named after its route
+type TracingInterceptor struct {
+	router *mux.Router
+}
+
+// NewTracingInterceptor returns a new instance of TracingInterceptor naming spans by the routes of router
+func NewTracingInterceptor(router *mux.Router) *TracingInterceptor {
+	return &TracingInterceptor{router: router}
+}
+
+func (rec *TracingInterceptor) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	route := routeName(rec.router, r)
+	ctx, span := helpers.Tracer().Start(ctx, route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", r.URL.Path),
+			helpers.AttributeBridgeTraceID.String(appkit.TraceIDFromHTTPRequest(r)),
+		))
+
+	next(rw, r.WithContext(ctx))
+	res := rw.(negroni.ResponseWriter)
+	helpers.EndSpan(span, res.Status(), nil)
+}
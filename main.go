@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
   _ "time/tzdata"
 	"github.com/paypermint/appkit"
 	"github.com/paypermint/bridge-app-svc/handlers"
 	"github.com/paypermint/bridge-app-svc/helpers"
 	"github.com/paypermint/bridge-app-svc/interceptors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/unrolled/render"
 	"github.com/unrolled/secure"
 	"github.com/urfave/negroni"
@@ -20,25 +26,152 @@ const (
 var (
 	dynamicHost      = flag.String("dynamic-host", "payscape.in", "Dynamic host")
 	bucketRegion     = flag.String("bucket-region", "", "Region for AWS where the bucket for file upload has been created")
+	bucketEndpoint   = flag.String("bucket-endpoint", "", "Endpoint of an S3 compatible store such as MinIO, AWS S3 if empty")
+	bucketPathStyle  = flag.Bool("bucket-path-style", true, "Address buckets of the bucket-endpoint by path instead of virtual host")
 	sapUserCredsPath = flag.String("sap-user-creds-path", "", "Secrets manager path where the sap user creds are stored")
-	sapURL           = flag.String("sap-base-url", "", "SAP Base URL")
+	sapURL           = flag.String("sap-base-url", "", "SAP Base URL, serving every profile unless sap-tenants is given")
+	sapTenants       = flag.String("sap-tenants", "", "Path of the JSON file with the SAP system and the Basic auth access keys of every merchant profile, reloaded when modified. Profiles without an entry are rejected, as are requests without a bearer token or a bound access key")
+	sapTenantsReload = flag.Duration("sap-tenants-reload-interval", 30*time.Second, "Interval the sap-tenants file is checked for modifications")
+	mappingProfiles  = flag.String("customer-mapping-profiles", "", "Path of the JSON file with the customer file mapping profiles")
+	stagingDir       = flag.String("staging-dir", filepath.Join(os.TempDir(), "bridge-app-svc"), "Directory customer files are staged in")
+	maxUploadSize    = flag.Int64("max-upload-size", 20<<20, "Maximum size in bytes of an uploaded customer file")
+	storePath        = flag.String("store-path", "", "Path of the SQLite database keeping the sync state, kept in memory if empty")
+	jobWorkers       = flag.Int("job-workers", 4, "Number of sync jobs run concurrently")
+	jobQueueSize     = flag.Int("job-queue-size", 100, "Number of sync jobs that can wait for a worker")
+	jobRetention     = flag.Duration("job-retention", 24*time.Hour, "Duration a finished sync job stays available for polling")
+	retryAttempts    = flag.Int("retry-attempts", 3, "Number of attempts of an outbound SAP or payabbhi request on retryable failures")
+	retryBaseDelay   = flag.Duration("retry-base-delay", 500*time.Millisecond, "Upper bound of the jittered delay before the first retry, doubled on every further retry")
+	retryMaxDelay    = flag.Duration("retry-max-delay", 10*time.Second, "Maximum delay between retries, also the longest Retry-After honoured")
+	breakerThreshold = flag.Int("breaker-threshold", 5, "Number of consecutive failures of an upstream opening its circuit breaker")
+	breakerTimeout   = flag.Duration("breaker-open-timeout", 30*time.Second, "Duration an open circuit breaker fails requests before letting a trial request through")
+	idempotencyTTL   = flag.Duration("idempotency-ttl", 24*time.Hour, "Duration the response of a request with an Idempotency-Key is replayed")
+	idempotencyLock  = flag.Duration("idempotency-lock-ttl", 5*time.Minute, "Duration an Idempotency-Key stays reserved by a request which does not complete, should exceed the longest request")
+	idempotencyRedis = flag.String("idempotency-redis-addr", "", "Address of the Redis keeping Idempotency-Key responses, kept in memory if empty. The password is read from IDEMPOTENCY_REDIS_PASSWORD")
+	idempotencyDB    = flag.Int("idempotency-redis-db", 0, "Redis database keeping Idempotency-Key responses")
+	invoiceSchedules = flag.String("invoice-schedules", "", "Path of the JSON file with the cron schedules pulling open items into payabbhi invoices")
+	otlpEndpoint     = flag.String("otlp-endpoint", "", "URL of the OTLP/HTTP collector spans are exported to, such as http://localhost:4318/v1/traces. Spans are not recorded if empty")
+	jwksSource       = flag.String("jwks", "", "Path or http(s) URL of the JSON Web Key Set bearer tokens are verified against, bearer tokens are passed on unverified if empty")
+	jwksCacheTTL     = flag.Duration("jwks-cache-ttl", time.Hour, "Duration a key set fetched from the jwks URL is kept before it is fetched again")
+	jwtAudience      = flag.String("jwt-audience", "", "Audience bearer tokens must be issued for, not checked if empty")
+	fxRates          = flag.String("fx-rates", "", "Path of the JSON file with the INR rates of the foreign currencies invoices and payments are synced in, only INR is supported if empty")
+	moneyRounding    = flag.String("money-rounding", helpers.RoundHalfUp, "Rounding of amounts with more decimals than their currency: half_up, half_even, down, up or unnecessary to reject them")
+	webhookTolerance = flag.Duration("webhook-tolerance", 5*time.Minute, "Maximum age of a payabbhi webhook signature. The secret of /webhooks/payabbhi is read from PAYABBHI_WEBHOOK_SECRET, the one of /webhooks/payabbhi/{profile_id} from the webhook_secret_env of the SAP tenant")
 )
 
 func main() {
 	appkit.RequireFlags(appkit.F_WEB | appkit.F_LOG | appkit.F_HEALTH | appkit.F_REGION)
 	flag.Parse()
 	config := appkit.GetAppConfig()
-	log := appkit.NewLogger(config.Log)
+	// credentials and PII are masked in everything logged through the app context
+	log := helpers.NewRedactingLogger(appkit.NewLogger(config.Log))
 	appctx := appkit.NewAppContext(config, log)
 
 	defer appctx.Cleanup()
 	grpclog.SetLogger(appkit.NewGrpcLogger(log))
+	shutdownTracing, err := helpers.InitTracing(serviceName, *otlpEndpoint)
+	if err != nil {
+		log.Crit("unable to set up tracing", "error_message", err.Error())
+		return
+	}
+	defer shutdownTracing(context.Background())
 	handlers.SetAppContext(appctx)
+	jobManager := helpers.NewJobManager(log, *jobWorkers, *jobQueueSize, *jobRetention)
+	handlers.SetJobManager(jobManager)
+	// the health check endpoint serves the default mux, /metrics is scraped on the health port
+	http.Handle("/metrics", promhttp.Handler())
 	go appkit.StartHealthCheckEndpoint(appctx)
 	helpers.SetDynamicHost(*dynamicHost)
-	helpers.SetBucketConfig(*bucketRegion)
+	helpers.SetBucketConfig(*bucketRegion, *bucketEndpoint, *bucketPathStyle)
 	helpers.SetSapUserCredsPath(*sapUserCredsPath)
 	helpers.SetSapURL(*sapURL)
+	if *sapTenants != "" {
+		tenants, err := helpers.LoadTenantRegistry(*sapTenants)
+		if err != nil {
+			log.Crit("unable to load SAP tenants", "error_message", err.Error())
+			return
+		}
+		helpers.SetTenantRegistry(tenants)
+		defer tenants.Watch(*sapTenantsReload, log)()
+	}
+	helpers.SetRetryPolicy(helpers.RetryPolicy{
+		MaxAttempts: *retryAttempts,
+		BaseDelay:   *retryBaseDelay,
+		MaxDelay:    *retryMaxDelay,
+	})
+	helpers.SetCircuitBreakerConfig(*breakerThreshold, *breakerTimeout)
+	if err := helpers.SetMoneyRounding(*moneyRounding); err != nil {
+		log.Crit("invalid money rounding", "error_message", err.Error())
+		return
+	}
+	if *fxRates != "" {
+		fxTable, err := helpers.LoadFXTable(*fxRates)
+		if err != nil {
+			log.Crit("unable to load FX rates", "error_message", err.Error())
+			return
+		}
+		helpers.SetFXTable(fxTable)
+	}
+	webhookSecret := os.Getenv("PAYABBHI_WEBHOOK_SECRET")
+	helpers.SetWebhookConfig(webhookSecret, *webhookTolerance)
+	if webhookSecret == "" {
+		log.Warn("no PAYABBHI_WEBHOOK_SECRET given, payabbhi webhooks without a profile will be rejected")
+	}
+	if *jwksSource != "" {
+		jwks, err := helpers.NewJWKS(*jwksSource, *jwksCacheTTL)
+		if err != nil {
+			log.Crit("unable to load bearer token key set", "error_message", err.Error())
+			return
+		}
+		helpers.SetJWTConfig(jwks, *jwtAudience)
+	} else {
+		log.Warn("no jwks given, bearer tokens will be passed on unverified")
+	}
+	if err := helpers.SetStagingConfig(*stagingDir, *maxUploadSize); err != nil {
+		log.Crit("unable to create staging directory", "error_message", err.Error())
+		return
+	}
+	if *mappingProfiles != "" {
+		if err := helpers.LoadMappingProfiles(*mappingProfiles); err != nil {
+			log.Crit("unable to load customer mapping profiles", "error_message", err.Error())
+			return
+		}
+	}
+	if *storePath != "" {
+		store, err := helpers.NewSQLiteStore(*storePath)
+		if err != nil {
+			log.Crit("unable to open sync state store", "error_message", err.Error())
+			return
+		}
+		defer store.Close()
+		helpers.SetStore(store)
+	} else {
+		log.Warn("no store-path given, sync state will be lost on restart")
+	}
+	var idempotencyStore helpers.IdempotencyStore = helpers.NewMemoryIdempotencyStore()
+	if *idempotencyRedis != "" {
+		redisStore := helpers.NewRedisIdempotencyStore(*idempotencyRedis, os.Getenv("IDEMPOTENCY_REDIS_PASSWORD"), *idempotencyDB)
+		if err := redisStore.Ping(context.Background()); err != nil {
+			log.Crit("unable to connect to idempotency redis", "error_message", err.Error())
+			return
+		}
+		defer redisStore.Close()
+		idempotencyStore = redisStore
+	}
+	var schedules []*helpers.InvoiceSchedule
+	if *invoiceSchedules != "" {
+		if schedules, err = helpers.LoadInvoiceSchedules(*invoiceSchedules); err != nil {
+			log.Crit("unable to load invoice schedules", "error_message", err.Error())
+			return
+		}
+	}
+	scheduler, err := helpers.NewScheduler(appctx, jobManager, schedules)
+	if err != nil {
+		log.Crit("unable to create invoice scheduler", "error_message", err.Error())
+		return
+	}
+	scheduler.Start()
+	defer scheduler.Stop()
+	handlers.SetScheduler(scheduler)
 	appctx.Renderer = render.New(render.Options{
 		IndentJSON: true,
 	})
@@ -55,6 +188,10 @@ func main() {
 	n.Use(interceptors.NewRecoveryInterceptor(appctx))
 	n.Use(negroni.HandlerFunc(secureMiddleware.HandlerFuncWithNext))
 	n.Use(interceptors.NewLoggingInterceptor(appctx))
+	n.Use(interceptors.NewMetricsInterceptor(router))
+	n.Use(interceptors.NewTracingInterceptor(router))
+	n.Use(interceptors.NewAuthInterceptor(appctx))
+	n.Use(interceptors.NewIdempotencyInterceptor(appctx, idempotencyStore, *idempotencyLock, *idempotencyTTL))
 	n.UseHandler(router)
 	appkit.StartWeb(appctx, n)
 }
@@ -0,0 +1,10 @@
+package models
+
+//CircuitBreaker is the API structure for the circuit breaker state of an upstream
+type CircuitBreaker struct {
+	Object              string `json:"object"`
+	Upstream            string `json:"upstream"`
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	OpenedAt            int64  `json:"opened_at,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+//CustomerSyncReport is the API structure for the outcome of a customer sync
+type CustomerSyncReport struct {
+	Object    string `json:"object"`
+	DryRun    bool   `json:"dry_run,omitempty"`
+	Created   int64  `json:"created"`
+	Updated   int64  `json:"updated"`
+	Unchanged int64  `json:"unchanged"`
+	// DeactivatedLocally counts the customers deactivated in the bridge, they stay active at payabbhi
+	DeactivatedLocally int64                 `json:"deactivated_locally"`
+	Skipped            int64                 `json:"skipped"`
+	Failed             int64                 `json:"failed"`
+	Rows               []*CustomerSyncResult `json:"rows"`
+}
+
+//CustomerSyncResult is the API structure for the outcome of a single row of a customer sync. Customers deactivated
+//for missing from the customer file have no row
+type CustomerSyncResult struct {
+	Row                int    `json:"row,omitempty"`
+	MerchantCustomerID string `json:"merchant_customer_id"`
+	Status             string `json:"status"`
+	CustomerID         string `json:"customer_id,omitempty"`
+	Field              string `json:"field,omitempty"`
+	Message            string `json:"message,omitempty"`
+	// Payload is set by a dry run, the request which would have been sent. Diff lists the fields an update changes
+	Payload interface{}    `json:"payload,omitempty"`
+	Diff    []*FieldChange `json:"diff,omitempty"`
+}
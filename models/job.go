@@ -0,0 +1,30 @@
+package models
+
+//Job is the API structure for an asynchronous sync job
+type Job struct {
+	ID          string            `json:"id"`
+	Object      string            `json:"object"`
+	Type        string            `json:"type"`
+	Status      string            `json:"status"`
+	Progress    JobProgress       `json:"progress"`
+	Errors      []*JobRecordError `json:"errors"`
+	Result      interface{}       `json:"result,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   int64             `json:"created_at"`
+	StartedAt   int64             `json:"started_at,omitempty"`
+	CompletedAt int64             `json:"completed_at,omitempty"`
+}
+
+//JobProgress is the API structure for the record counts of a job
+type JobProgress struct {
+	Total     int64 `json:"total"`
+	Processed int64 `json:"processed"`
+	Failed    int64 `json:"failed"`
+}
+
+//JobRecordError is the API structure for a record that failed within a job
+type JobRecordError struct {
+	Record  string `json:"record"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,16 @@
+package models
+
+//PaymentPosting is the API structure for a payment confirmation which has been posted to the ERP
+type PaymentPosting struct {
+	TransactionRef string `json:"transaction_ref"`
+	CompanyCode    string `json:"company_code"`
+	Status         string `json:"status"`
+	PostedAt       int64  `json:"posted_at"`
+}
+
+//PaymentDuplicate is the API structure for a record left out of a payment submission as it repeats an earlier record of the submission
+type PaymentDuplicate struct {
+	Index          int    `json:"index"`
+	TransactionRef string `json:"transaction_ref"`
+	CompanyCode    string `json:"company_code"`
+}
@@ -0,0 +1,28 @@
+package models
+
+//Schedule is the API structure for a scheduled invoice pull
+type Schedule struct {
+	Name      string `json:"name"`
+	Object    string `json:"object"`
+	ProfileID string `json:"profile_id"`
+	Cron      string `json:"cron"`
+	SyncWith  string `json:"sync_with"`
+	Mode      string `json:"mode"`
+	NextRunAt int64  `json:"next_run_at,omitempty"`
+	LastRunAt int64  `json:"last_run_at,omitempty"`
+}
+
+//ScheduleRun is the API structure for a run of a schedule
+type ScheduleRun struct {
+	ID          string `json:"id"`
+	Object      string `json:"object"`
+	Schedule    string `json:"schedule"`
+	ProfileID   string `json:"profile_id"`
+	Status      string `json:"status"`
+	Customers   int    `json:"customers"`
+	Items       int    `json:"items"`
+	Failed      int    `json:"failed"`
+	Error       string `json:"error,omitempty"`
+	StartedAt   int64  `json:"started_at"`
+	CompletedAt int64  `json:"completed_at,omitempty"`
+}
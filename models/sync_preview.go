@@ -0,0 +1,28 @@
+package models
+
+//SyncPreview is the API structure for the outcome of a dry run, nothing has been written
+type SyncPreview struct {
+	Object string `json:"object"`
+	DryRun bool   `json:"dry_run"`
+	// Payload is the request which would have been sent for all items at once
+	Payload interface{}        `json:"payload,omitempty"`
+	Items   []*SyncPreviewItem `json:"items"`
+}
+
+//SyncPreviewItem is the API structure for what a sync would do with a single record
+type SyncPreviewItem struct {
+	Key     string         `json:"key"`
+	Action  string         `json:"action"`
+	Payload interface{}    `json:"payload,omitempty"`
+	Current interface{}    `json:"current,omitempty"`
+	Diff    []*FieldChange `json:"diff,omitempty"`
+	Field   string         `json:"field,omitempty"`
+	Message string         `json:"message,omitempty"`
+}
+
+//FieldChange is the API structure for a field whose value differs from the one last synced
+type FieldChange struct {
+	Field    string      `json:"field"`
+	Current  interface{} `json:"current"`
+	Proposed interface{} `json:"proposed"`
+}
@@ -0,0 +1,11 @@
+package models
+
+//WebhookEventResult is the API structure for what was done with a received webhook event
+type WebhookEventResult struct {
+	Object string `json:"object"`
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	// Response is the ERP response of the posted payment confirmations
+	Response interface{} `json:"response,omitempty"`
+}
@@ -20,6 +20,12 @@ func setRouter() *mux.Router {
 			Pattern:     "/customers",
 			HandlerFunc: handlers.SyncCustomers,
 		},
+		models.Route{
+			Name:        "UploadCustomersAPI",
+			Methods:     []string{"POST"},
+			Pattern:     "/customers/uploads",
+			HandlerFunc: handlers.UploadCustomers,
+		},
 		models.Route{
 			Name:        "SyncInvoices",
 			Methods:     []string{"PUT"},
@@ -32,6 +38,54 @@ func setRouter() *mux.Router {
 			Pattern:     "/payments",
 			HandlerFunc: handlers.SyncPayments,
 		},
+		models.Route{
+			Name:        "GetJob",
+			Methods:     []string{"GET"},
+			Pattern:     "/jobs/{id}",
+			HandlerFunc: handlers.GetJob,
+		},
+		models.Route{
+			Name:        "GetJobReport",
+			Methods:     []string{"GET"},
+			Pattern:     "/jobs/{id}/report",
+			HandlerFunc: handlers.GetJobReport,
+		},
+		models.Route{
+			Name:        "CancelJob",
+			Methods:     []string{"DELETE"},
+			Pattern:     "/jobs/{id}",
+			HandlerFunc: handlers.CancelJob,
+		},
+		models.Route{
+			Name:        "GetCircuitBreakers",
+			Methods:     []string{"GET"},
+			Pattern:     "/circuit_breakers",
+			HandlerFunc: handlers.GetCircuitBreakers,
+		},
+		models.Route{
+			Name:        "GetSchedules",
+			Methods:     []string{"GET"},
+			Pattern:     "/schedules",
+			HandlerFunc: handlers.GetSchedules,
+		},
+		models.Route{
+			Name:        "GetScheduleRuns",
+			Methods:     []string{"GET"},
+			Pattern:     "/schedules/{name}/runs",
+			HandlerFunc: handlers.GetScheduleRuns,
+		},
+		models.Route{
+			Name:        "ReceivePayabbhiWebhook",
+			Methods:     []string{"POST"},
+			Pattern:     "/webhooks/payabbhi",
+			HandlerFunc: handlers.ReceivePayabbhiWebhook,
+		},
+		models.Route{
+			Name:        "ReceivePayabbhiProfileWebhook",
+			Methods:     []string{"POST"},
+			Pattern:     "/webhooks/payabbhi/{profile_id}",
+			HandlerFunc: handlers.ReceivePayabbhiWebhook,
+		},
 	}
 
 	for _, route := range routesList {
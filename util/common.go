@@ -11,12 +11,12 @@ const (
 
 //ProfileIDFromHTTPRequest reads the Profile-Id field set in header
 func ProfileIDFromHTTPRequest(r *http.Request) string {
-	return r.Header.Get("Profile-Id")
+	return r.Header.Get(KeyProfileID)
 }
 
 //EnvironmentFromHTTPRequest reads the Profile-Id field set in header
 func EnvironmentFromHTTPRequest(r *http.Request) string {
-	return r.Header.Get("Environment")
+	return r.Header.Get(KeyEnvironment)
 }
 
 //VersionFromHTTPRequest reads the Profile-Id field set in header
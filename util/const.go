@@ -54,6 +54,11 @@ const (
 	KeyGstin           = "gstin"
 	KeyShippingAddress = "shipping_address"
 	KeyBillingAddress  = "billing_address"
+	// the fields of the addresses are named by their dotted path
+	KeyBillingAddressState  = "billing_address.state"
+	KeyBillingAddressPin    = "billing_address.pin"
+	KeyShippingAddressState = "shipping_address.state"
+	KeyShippingAddressPin   = "shipping_address.pin"
 )
 
 //Create Plan API Key Constants
@@ -174,6 +179,54 @@ const (
 	MissingMandatoryField = "Required field does not have a value"
 	//InvalidHsnSacCodeMsg is given when both HSN and SAC code is passed from API side
 	InvalidHsnSacCodeMsg = "This line item cannot be added with both hsn_code and sac_code"
+	//UnsupportedConnectorMsg is given when the sync_with header does not name a registered connector
+	UnsupportedConnectorMsg = "The system specified in sync_with is not supported"
+	//EmptyFileMsg is given when an uploaded or referenced file has no content
+	EmptyFileMsg = "The file does not have any content"
+	//UploadTooLargeMsg is given when an upload exceeds the maximum upload size
+	UploadTooLargeMsg = "The uploaded file exceeds the maximum allowed size"
+	//UnsupportedFileContentMsg is given when an upload is not a supported file
+	UnsupportedFileContentMsg = "The uploaded file content is not supported"
+	//JobNotFoundMsg is given when no job exists for the requested id
+	JobNotFoundMsg = "No job exists for the given id"
+	//JobFinishedMsg is given when cancelling a job which has already finished
+	JobFinishedMsg = "The job has already finished"
+	//JobReportNotFoundMsg is given when a job has no downloadable report
+	JobReportNotFoundMsg = "No report is available for the given job"
+	//JobQueueFullMsg is given when the job queue can not accept more jobs
+	JobQueueFullMsg = "Too many sync jobs are pending, please retry later"
+	//UpstreamUnavailableMsg is given when the circuit breaker of an upstream fails the request
+	UpstreamUnavailableMsg = "The upstream system is unavailable, please retry later"
+	//PaymentPostingInProgressMsg is given when a record is submitted while an earlier submission is posting it
+	PaymentPostingInProgressMsg = "The payment confirmation is being posted by an earlier request"
+	//IdempotencyKeyReusedMsg is given when an Idempotency-Key is sent again with a different request
+	IdempotencyKeyReusedMsg = "The Idempotency-Key has been used for a different request"
+	//IdempotencyKeyInProgressMsg is given when an Idempotency-Key is sent again before its request has completed
+	IdempotencyKeyInProgressMsg = "A request with the Idempotency-Key is still being processed"
+	//ScheduleNotFoundMsg is given when no invoice schedule exists for the requested name
+	ScheduleNotFoundMsg = "No schedule exists for the given name"
+	//InvalidWebhookSignatureMsg is given when a webhook is not signed with the webhook secret
+	InvalidWebhookSignatureMsg = "The webhook signature does not match its payload"
+	//InvalidBearerTokenMsg is given when a bearer token fails verification
+	InvalidBearerTokenMsg = "The bearer token is invalid or has expired"
+	//InvalidCredentialsMsg is given when the secret key of an access id bound to a profile does not match
+	InvalidCredentialsMsg = "The access id or secret key is invalid"
+	//ProfileNotAuthenticatedMsg is given when the Profile-Id of a request is not the profile of its credentials
+	ProfileNotAuthenticatedMsg = "The credentials are not authorised for the Profile-Id"
+	//MissingProfileCredentialsMsg is given when a request carries neither a bearer token nor an access id bound to a profile
+	MissingProfileCredentialsMsg = "The request carries no bearer token or access key of a profile"
+	//UnknownTenantMsg is given when no ERP system is configured for the profile of a request
+	UnknownTenantMsg = "No ERP system is configured for the profile"
+	//UnsupportedCurrencyMsg is given for a currency without a rate in the FX rate table
+	UnsupportedCurrencyMsg = "The currency is not supported"
+	//InvalidGstinMsg is given for a GSTIN with a wrong format, state code or check character
+	InvalidGstinMsg = "The GSTIN is invalid"
+	//GstinStateMismatchMsg is given when a GSTIN is registered in a state other than the billing state
+	GstinStateMismatchMsg = "The GSTIN is not registered in the billing state"
+	//InvalidPinMsg is given for a PIN code which is not six digits or not in the state of the address
+	InvalidPinMsg = "The PIN code is invalid for the state"
+	//InvalidStateMsg is given for a state which is not a state or union territory of India
+	InvalidStateMsg = "The state is not a state or union territory of India"
 )
 
 const (
@@ -226,7 +279,13 @@ const (
 )
 
 const (
-	KeyContentType = "Content-Type"
+	KeyContentType       = "Content-Type"
+	KeyIdempotencyKey    = "Idempotency-Key"
+	KeyIdempotentReplay  = "Idempotent-Replayed"
+	KeyPayabbhiSignature = "X-Payabbhi-Signature"
+	KeyAuthorization     = "Authorization"
+	KeyProfileID         = "Profile-Id"
+	KeyEnvironment       = "Environment"
 )
 
 const (
@@ -256,10 +315,16 @@ const (
 )
 
 const (
-	KeyFilePath = "file_path"
+	KeyFile           = "file"
+	KeyFilePath       = "file_path"
+	KeyMappingProfile = "mapping_profile"
+	KeySheet          = "sheet"
+	// KeyDeactivateMissing deactivates the synced customers missing from the customer file
+	KeyDeactivateMissing = "deactivate_missing"
 )
 
 const (
+	KeySyncWith          = "sync_with"
 	SyncWithSAP          = "SAP"
 	KeySapAmountDue      = "amount_due"
 	KeySapCompanyCode    = "company_code"
@@ -267,12 +332,19 @@ const (
 	KeySapCustomerNumber = "customer_number"
 	KeySapDescription    = "description"
 	KeySapItem           = "item"
+	KeySapCurrency       = "currency"
 )
 
 const (
 	CurrencyINR = "INR"
 )
 
+//dry_run previews a sync without writing to payabbhi or the ERP, force repeats writes made before
+const (
+	KeyDryRun = "dry_run"
+	KeyForce  = "force"
+)
+
 //for payment update notification to SAP
 const (
 	KeyRecords        = "Records"
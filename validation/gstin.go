@@ -0,0 +1,83 @@
+package validation
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+// gstinCharset holds the characters of a GSTIN by their value in the checksum
+const gstinCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// otherTerritoryCode is the GST state code of supplies to and from other territories such as offshore areas
+const otherTerritoryCode = "97"
+
+// gstinPattern matches the format of a GSTIN, the state code followed by the PAN, entity number, Z and checksum
+var gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+
+var (
+	//ErrInvalidGSTIN is returned for a GSTIN whose format, state code or check character is wrong
+	ErrInvalidGSTIN = errors.New(util.InvalidGstinMsg)
+	//ErrGSTINStateMismatch is returned for a GSTIN registered in a state other than the one of the address
+	ErrGSTINStateMismatch = errors.New(util.GstinStateMismatchMsg)
+)
+
+//ValidateGSTIN checks the format, state code and check character of a GSTIN
+func ValidateGSTIN(gstin string) error {
+	gstin = strings.ToUpper(gstin)
+	if !gstinPattern.MatchString(gstin) {
+		return ErrInvalidGSTIN
+	}
+	if _, ok := stateByCode(gstin[:2]); !ok && gstin[:2] != otherTerritoryCode {
+		return ErrInvalidGSTIN
+	}
+	if gstinCheckChar(gstin[:14]) != gstin[14] {
+		return ErrInvalidGSTIN
+	}
+	return nil
+}
+
+//GSTINStateCode returns the GST state code of a valid GSTIN, the current code for GSTINs of reorganised states
+func GSTINStateCode(gstin string) (string, error) {
+	if err := ValidateGSTIN(gstin); err != nil {
+		return "", err
+	}
+	if state, ok := stateByCode(gstin[:2]); ok {
+		return state.Code, nil
+	}
+	return otherTerritoryCode, nil
+}
+
+//ValidateGSTINState checks that a valid GSTIN is registered in the named state. GSTINs of other territories are not
+//registered in a state and match any state
+func ValidateGSTINState(gstin, stateName string) error {
+	code, err := GSTINStateCode(gstin)
+	if err != nil {
+		return err
+	}
+	if code == otherTerritoryCode {
+		return nil
+	}
+	state, err := LookupState(stateName)
+	if err != nil {
+		return err
+	}
+	if state.Code != code {
+		return ErrGSTINStateMismatch
+	}
+	return nil
+}
+
+// gstinCheckChar computes the check character of the first 14 characters of a GSTIN. Every character is weighted
+// alternately by 1 and 2, the digits of the products in base 36 are summed and the check character makes the sum
+// a multiple of 36
+func gstinCheckChar(base string) byte {
+	sum := 0
+	for i := 0; i < len(base); i++ {
+		product := strings.IndexByte(gstinCharset, base[i]) * (i%2 + 1)
+		sum += product/len(gstinCharset) + product%len(gstinCharset)
+	}
+	return gstinCharset[(len(gstinCharset)-sum%len(gstinCharset))%len(gstinCharset)]
+}
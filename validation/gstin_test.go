@@ -0,0 +1,108 @@
+package validation
+
+import "testing"
+
+func TestValidateGSTIN(t *testing.T) {
+	tests := []struct {
+		name    string
+		gstin   string
+		wantErr bool
+	}{
+		{name: "maharashtra", gstin: "27AAPFU0939F1ZV"},
+		{name: "karnataka", gstin: "29AAGCB7383J1Z4"},
+		{name: "delhi", gstin: "07AAACB1234C1ZH"},
+		{name: "lower case", gstin: "33abcde1234f2z6"},
+		{name: "other territory", gstin: "97AAPFU0939F1ZO"},
+		{name: "former daman and diu", gstin: "25AAPFU0939F1ZZ"},
+		{name: "former andhra pradesh", gstin: "28AAPFU0939F1ZT"},
+		{name: "wrong check character", gstin: "27AAPFU0939F1ZA", wantErr: true},
+		{name: "swapped characters", gstin: "27AAPFU0939F1VZ", wantErr: true},
+		{name: "transposed pan digits", gstin: "27AAPFU9039F1ZV", wantErr: true},
+		{name: "unknown state code", gstin: "99AAPFU0939F1ZV", wantErr: true},
+		{name: "zero entity number", gstin: "27AAPFU0939F0ZV", wantErr: true},
+		{name: "no Z", gstin: "27AAPFU0939F1YV", wantErr: true},
+		{name: "too short", gstin: "27AAPFU0939F1Z", wantErr: true},
+		{name: "empty", gstin: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateGSTIN(tt.gstin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateGSTIN(%q) error = %v, want error %v", tt.gstin, err, tt.wantErr)
+			}
+			if err != nil && err != ErrInvalidGSTIN {
+				t.Fatalf("ValidateGSTIN(%q) error = %v, want %v", tt.gstin, err, ErrInvalidGSTIN)
+			}
+		})
+	}
+}
+
+func TestGSTINCheckChar(t *testing.T) {
+	tests := []struct {
+		base string
+		want byte
+	}{
+		{base: "27AAPFU0939F1Z", want: 'V'},
+		{base: "29AAGCB7383J1Z", want: '4'},
+		{base: "07AAACB1234C1Z", want: 'H'},
+		{base: "97AAPFU0939F1Z", want: 'O'},
+	}
+	for _, tt := range tests {
+		t.Run(tt.base, func(t *testing.T) {
+			if got := gstinCheckChar(tt.base); got != tt.want {
+				t.Fatalf("gstinCheckChar(%q) = %c, want %c", tt.base, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGSTINStateCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		gstin string
+		want  string
+	}{
+		{name: "current code", gstin: "27AAPFU0939F1ZV", want: "27"},
+		{name: "daman and diu remapped", gstin: "25AAPFU0939F1ZZ", want: "26"},
+		{name: "andhra pradesh remapped", gstin: "28AAPFU0939F1ZT", want: "37"},
+		{name: "other territory", gstin: "97AAPFU0939F1ZO", want: "97"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GSTINStateCode(tt.gstin)
+			if err != nil {
+				t.Fatalf("GSTINStateCode(%q) error = %v", tt.gstin, err)
+			}
+			if got != tt.want {
+				t.Fatalf("GSTINStateCode(%q) = %s, want %s", tt.gstin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateGSTINState(t *testing.T) {
+	tests := []struct {
+		name    string
+		gstin   string
+		state   string
+		wantErr error
+	}{
+		{name: "same state", gstin: "27AAPFU0939F1ZV", state: "Maharashtra"},
+		{name: "state alias", gstin: "27AAPFU0939F1ZV", state: "MH"},
+		{name: "other state", gstin: "27AAPFU0939F1ZV", state: "Karnataka", wantErr: ErrGSTINStateMismatch},
+		{name: "former daman and diu code", gstin: "25AAPFU0939F1ZZ", state: "Daman and Diu"},
+		{name: "former daman and diu code in merged state", gstin: "25AAPFU0939F1ZZ", state: "Dadra and Nagar Haveli and Daman and Diu"},
+		{name: "former andhra pradesh code", gstin: "28AAPFU0939F1ZT", state: "Andhra Pradesh"},
+		{name: "former andhra pradesh code in telangana", gstin: "28AAPFU0939F1ZT", state: "Telangana", wantErr: ErrGSTINStateMismatch},
+		{name: "other territory in any state", gstin: "97AAPFU0939F1ZO", state: "Kerala"},
+		{name: "unknown state", gstin: "27AAPFU0939F1ZV", state: "Atlantis", wantErr: ErrUnknownState},
+		{name: "invalid gstin", gstin: "27AAPFU0939F1ZA", state: "Maharashtra", wantErr: ErrInvalidGSTIN},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateGSTINState(tt.gstin, tt.state); err != tt.wantErr {
+				t.Fatalf("ValidateGSTINState(%q, %q) error = %v, want %v", tt.gstin, tt.state, err, tt.wantErr)
+			}
+		})
+	}
+}
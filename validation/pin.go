@@ -0,0 +1,35 @@
+package validation
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+// pinPattern matches a PIN code, six digits not starting with 0
+var pinPattern = regexp.MustCompile(`^[1-9][0-9]{5}$`)
+
+//ErrInvalidPIN is returned for a PIN code which is malformed or outside the PIN codes of its state
+var ErrInvalidPIN = errors.New(util.InvalidPinMsg)
+
+//ValidatePIN checks that a PIN code is six digits and, when the state is given, among the PIN codes of the state
+func ValidatePIN(pin, stateName string) error {
+	if !pinPattern.MatchString(pin) {
+		return ErrInvalidPIN
+	}
+	if stateName == "" {
+		return nil
+	}
+	state, err := LookupState(stateName)
+	if err != nil {
+		return err
+	}
+	for _, prefix := range state.pinPrefixes {
+		if strings.HasPrefix(pin, prefix) {
+			return nil
+		}
+	}
+	return ErrInvalidPIN
+}
@@ -0,0 +1,36 @@
+package validation
+
+import "testing"
+
+func TestValidatePIN(t *testing.T) {
+	tests := []struct {
+		name    string
+		pin     string
+		state   string
+		wantErr error
+	}{
+		{name: "without state", pin: "400001"},
+		{name: "maharashtra", pin: "400001", state: "Maharashtra"},
+		{name: "delhi", pin: "110001", state: "Delhi"},
+		{name: "three digit prefix", pin: "403001", state: "Goa"},
+		{name: "chandigarh within punjab prefixes", pin: "160017", state: "Chandigarh"},
+		{name: "shared prefix telangana", pin: "500001", state: "Telangana"},
+		{name: "shared prefix andhra pradesh", pin: "500001", state: "Andhra Pradesh"},
+		{name: "merged union territory", pin: "396210", state: "Dadra and Nagar Haveli and Daman and Diu"},
+		{name: "state alias", pin: "560001", state: "KA"},
+		{name: "other state", pin: "400001", state: "Karnataka", wantErr: ErrInvalidPIN},
+		{name: "outside three digit prefix", pin: "404001", state: "Goa", wantErr: ErrInvalidPIN},
+		{name: "leading zero", pin: "040001", wantErr: ErrInvalidPIN},
+		{name: "five digits", pin: "40001", wantErr: ErrInvalidPIN},
+		{name: "seven digits", pin: "4000011", wantErr: ErrInvalidPIN},
+		{name: "space", pin: "400 001", wantErr: ErrInvalidPIN},
+		{name: "unknown state", pin: "400001", state: "Atlantis", wantErr: ErrUnknownState},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePIN(tt.pin, tt.state); err != tt.wantErr {
+				t.Fatalf("ValidatePIN(%q, %q) error = %v, want %v", tt.pin, tt.state, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/paypermint/bridge-app-svc/util"
+)
+
+//ErrUnknownState is returned for a name which is not a state or union territory of India
+var ErrUnknownState = errors.New(util.InvalidStateMsg)
+
+//State is a state or union territory of India
+type State struct {
+	// Name is the canonical name of the state
+	Name string
+	// Code is the GST state code, the first two digits of the GSTINs registered in the state
+	Code string
+	// pinPrefixes are the leading digits of the PIN codes of the state
+	pinPrefixes []string
+	// aliases are former names, abbreviations and common spellings of the state
+	aliases []string
+}
+
+// states lists the states and union territories with their GST state code, the ISO 3166-2 code is an alias
+var states = []*State{
+	{Name: "Jammu and Kashmir", Code: "01", pinPrefixes: []string{"18", "19"}, aliases: []string{"JK", "J&K", "Jammu & Kashmir"}},
+	{Name: "Himachal Pradesh", Code: "02", pinPrefixes: []string{"17"}, aliases: []string{"HP"}},
+	{Name: "Punjab", Code: "03", pinPrefixes: []string{"14", "15", "16"}, aliases: []string{"PB"}},
+	{Name: "Chandigarh", Code: "04", pinPrefixes: []string{"160"}, aliases: []string{"CH"}},
+	{Name: "Uttarakhand", Code: "05", pinPrefixes: []string{"24", "26"}, aliases: []string{"UK", "UT", "Uttaranchal"}},
+	{Name: "Haryana", Code: "06", pinPrefixes: []string{"12", "13"}, aliases: []string{"HR"}},
+	{Name: "Delhi", Code: "07", pinPrefixes: []string{"11"}, aliases: []string{"DL", "New Delhi", "NCT of Delhi", "National Capital Territory of Delhi"}},
+	{Name: "Rajasthan", Code: "08", pinPrefixes: []string{"30", "31", "32", "33", "34"}, aliases: []string{"RJ"}},
+	{Name: "Uttar Pradesh", Code: "09", pinPrefixes: []string{"20", "21", "22", "23", "24", "25", "26", "27", "28"}, aliases: []string{"UP"}},
+	{Name: "Bihar", Code: "10", pinPrefixes: []string{"80", "81", "82", "83", "84", "85"}, aliases: []string{"BR"}},
+	{Name: "Sikkim", Code: "11", pinPrefixes: []string{"737"}, aliases: []string{"SK"}},
+	{Name: "Arunachal Pradesh", Code: "12", pinPrefixes: []string{"790", "791", "792"}, aliases: []string{"AR"}},
+	{Name: "Nagaland", Code: "13", pinPrefixes: []string{"797", "798"}, aliases: []string{"NL"}},
+	{Name: "Manipur", Code: "14", pinPrefixes: []string{"795"}, aliases: []string{"MN"}},
+	{Name: "Mizoram", Code: "15", pinPrefixes: []string{"796"}, aliases: []string{"MZ"}},
+	{Name: "Tripura", Code: "16", pinPrefixes: []string{"799"}, aliases: []string{"TR"}},
+	{Name: "Meghalaya", Code: "17", pinPrefixes: []string{"793", "794"}, aliases: []string{"ML"}},
+	{Name: "Assam", Code: "18", pinPrefixes: []string{"78"}, aliases: []string{"AS"}},
+	{Name: "West Bengal", Code: "19", pinPrefixes: []string{"70", "71", "72", "73", "74"}, aliases: []string{"WB"}},
+	{Name: "Jharkhand", Code: "20", pinPrefixes: []string{"81", "82", "83"}, aliases: []string{"JH"}},
+	{Name: "Odisha", Code: "21", pinPrefixes: []string{"75", "76", "77"}, aliases: []string{"OD", "OR", "Orissa"}},
+	{Name: "Chhattisgarh", Code: "22", pinPrefixes: []string{"49"}, aliases: []string{"CG", "CT", "Chattisgarh"}},
+	{Name: "Madhya Pradesh", Code: "23", pinPrefixes: []string{"45", "46", "47", "48"}, aliases: []string{"MP"}},
+	{Name: "Gujarat", Code: "24", pinPrefixes: []string{"36", "37", "38", "39"}, aliases: []string{"GJ"}},
+	{Name: "Dadra and Nagar Haveli and Daman and Diu", Code: "26", pinPrefixes: []string{"362", "396"},
+		aliases: []string{"DH", "DN", "DD", "Daman and Diu", "Dadra and Nagar Haveli"}},
+	{Name: "Maharashtra", Code: "27", pinPrefixes: []string{"40", "41", "42", "43", "44"}, aliases: []string{"MH"}},
+	{Name: "Karnataka", Code: "29", pinPrefixes: []string{"56", "57", "58", "59"}, aliases: []string{"KA"}},
+	{Name: "Goa", Code: "30", pinPrefixes: []string{"403"}, aliases: []string{"GA"}},
+	{Name: "Lakshadweep", Code: "31", pinPrefixes: []string{"682"}, aliases: []string{"LD"}},
+	{Name: "Kerala", Code: "32", pinPrefixes: []string{"67", "68", "69"}, aliases: []string{"KL"}},
+	{Name: "Tamil Nadu", Code: "33", pinPrefixes: []string{"60", "61", "62", "63", "64"}, aliases: []string{"TN"}},
+	{Name: "Puducherry", Code: "34", pinPrefixes: []string{"533", "605", "607", "609", "673"}, aliases: []string{"PY", "Pondicherry"}},
+	{Name: "Andaman and Nicobar Islands", Code: "35", pinPrefixes: []string{"744"}, aliases: []string{"AN", "Andaman & Nicobar"}},
+	{Name: "Telangana", Code: "36", pinPrefixes: []string{"50"}, aliases: []string{"TG", "TS"}},
+	{Name: "Andhra Pradesh", Code: "37", pinPrefixes: []string{"50", "51", "52", "53"}, aliases: []string{"AP"}},
+	{Name: "Ladakh", Code: "38", pinPrefixes: []string{"194"}, aliases: []string{"LA"}},
+}
+
+// formerStateCodes are GST state codes still found on GSTINs registered before states were reorganised
+var formerStateCodes = map[string]string{
+	// Daman and Diu merged with Dadra and Nagar Haveli in 2020
+	"25": "26",
+	// Andhra Pradesh before the formation of Telangana
+	"28": "37",
+}
+
+var (
+	statesByKey  = map[string]*State{}
+	statesByCode = map[string]*State{}
+)
+
+func init() {
+	for _, state := range states {
+		statesByKey[stateKey(state.Name)] = state
+		statesByKey[state.Code] = state
+		for _, alias := range state.aliases {
+			statesByKey[stateKey(alias)] = state
+		}
+		statesByCode[state.Code] = state
+	}
+}
+
+// stateKey folds a state name for lookup, ignoring case, punctuation, repeated spaces and & for and
+func stateKey(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, "&", " and "))
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return ' '
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+//LookupState returns the state named by its canonical name, a former name, its ISO 3166-2 code or its GST state code
+func LookupState(name string) (*State, error) {
+	if state, ok := statesByKey[stateKey(name)]; ok {
+		return state, nil
+	}
+	return nil, ErrUnknownState
+}
+
+//NormaliseState returns the canonical name of a state
+func NormaliseState(name string) (string, error) {
+	state, err := LookupState(name)
+	if err != nil {
+		return name, err
+	}
+	return state.Name, nil
+}
+
+// stateByCode returns the state of a GST state code, mapping former codes to the state they belong to now
+func stateByCode(code string) (*State, bool) {
+	if current, ok := formerStateCodes[code]; ok {
+		code = current
+	}
+	state, ok := statesByCode[code]
+	return state, ok
+}